@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/ed25519"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"go.uber.org/zap"
@@ -23,7 +25,6 @@ import (
 	"github.com/spacemeshos/post/internal/postrs"
 	"github.com/spacemeshos/post/proving"
 	"github.com/spacemeshos/post/shared"
-	"github.com/spacemeshos/post/verifying"
 )
 
 const edKeyFileName = "identity.key"
@@ -37,15 +38,38 @@ var (
 	printNumFiles  bool
 	printConfig    bool
 	genProof       bool
+	challengeHex   string
+	proofFile      string
 
-	verifyPos bool
-	fraction  float64
+	verifyPos     bool
+	fraction      float64
+	verifyReport  bool
+	verifyWorkers int
+	verifyState   string
+
+	repair       bool
+	repairReport string
+
+	verifyProof      string
+	verifyProofMode  string
+	verifyProofIndex int
+	verifyProofK3    uint
+
+	inspectProof string
+
+	serve         string
+	serveDatadirs datadirsFlag
 
 	idHex              string
 	commitmentAtxIdHex string
 	reset              bool
 	numUnits           uint64
 
+	batchLatency   time.Duration
+	batchMaxMemory uint64
+
+	schedule string
+
 	yes      bool
 	logLevel zapcore.Level
 
@@ -57,6 +81,21 @@ var (
 func parseFlags() {
 	flag.BoolVar(&verifyPos, "verify", false, "verify initialized data")
 	flag.Float64Var(&fraction, "fraction", 0.2, "how much % of POS data to verify. Sane values are < 1.0")
+	flag.BoolVar(&verifyReport, "verifyReport", false,
+		"with -verify, don't stop at the first invalid label and print a JSON report of all invalid labels per file",
+	)
+
+	flag.IntVar(&verifyWorkers, "verifyWorkers", 1, "number of files to verify at the same time with -verify")
+	flag.StringVar(&verifyState, "verifyState", "",
+		"file to record the progress of -verify in. If it exists, verification resumes where the last run stopped",
+	)
+	flag.BoolVar(&repair, "repair", false,
+		"recompute and overwrite the invalid labels in -datadir found by verifying -fraction % of the data. "+
+			"Labels that weren't sampled aren't repaired",
+	)
+	flag.StringVar(&repairReport, "repairReport", "",
+		"with -repair, repair the invalid labels listed in the given report written by -verify -verifyReport",
+	)
 
 	flag.BoolVar(&yes, "yes", false, "confirm potentially dangerous actions")
 	flag.TextVar(&logLevel, "logLevel", zapcore.InfoLevel, "log level (debug, info, warn, error, dpanic, panic, fatal)")
@@ -66,6 +105,31 @@ func parseFlags() {
 	flag.BoolVar(&printNumFiles, "printNumFiles", false, "print the total number of files that would be initialized")
 	flag.BoolVar(&printConfig, "printConfig", false, "print the used config and options")
 	flag.BoolVar(&genProof, "genproof", false, "generate proof as a sanity test, after initialization")
+	flag.StringVar(&challengeHex, "challenge", hex.EncodeToString(shared.ZeroChallenge),
+		"challenge to generate the proof for with -genproof, in hex",
+	)
+	flag.StringVar(&proofFile, "proofFile", "", "file to write the proof generated with -genproof to")
+	flag.StringVar(&verifyProof, "verifyProof", "", "verify the proof in the given file written with -proofFile")
+	flag.StringVar(&verifyProofMode, "verifyProofMode", "all",
+		"indices of the proof to verify with -verifyProof (all, subset, index)",
+	)
+	flag.IntVar(&verifyProofIndex, "verifyProofIndex", 0,
+		"ordinal of the index to verify with -verifyProofMode=index",
+	)
+	flag.UintVar(&verifyProofK3, "verifyProofK3", 0,
+		"number of indices to verify with -verifyProofMode=subset (defaults to K2 of the proof)",
+	)
+
+	flag.StringVar(&inspectProof, "inspectProof", "",
+		"compare the labels referenced by the proof in the given file with the labels stored in -datadir",
+	)
+
+	flag.StringVar(&serve, "serve", "",
+		"serve proof generation over HTTP on the given address (e.g. localhost:9094) until interrupted",
+	)
+	flag.Var(&serveDatadirs, "serveDatadir",
+		"with -serve, serve the datadir at path under name, given as name=path. Can be repeated. Defaults to -datadir",
+	)
 
 	flag.StringVar(&opts.DataDir, "datadir", opts.DataDir, "filesystem datadir path")
 	flag.Uint64Var(&opts.MaxFileSize, "maxFileSize", opts.MaxFileSize, "max file size")
@@ -78,6 +142,17 @@ func parseFlags() {
 	flag.StringVar(&commitmentAtxIdHex, "commitmentAtxId", "", "commitment atx id, in hex (required)")
 	flag.Uint64Var(&numUnits, "numUnits", 0, "number of units (required)")
 
+	flag.DurationVar(&batchLatency, "batchLatency", 0,
+		"tune the compute batch size automatically so that computing a batch takes about this long (e.g. 5s)",
+	)
+	flag.Uint64Var(&batchMaxMemory, "batchMaxMemory", initialization.DefaultBatchMaxMemory,
+		"max memory in bytes used for a batch of labels when -batchLatency is set",
+	)
+
+	flag.StringVar(&schedule, "schedule", "",
+		"only initialize within these daily windows of local time, e.g. \"22:00-06:00,12:00-13:30\"",
+	)
+
 	flag.IntVar(&opts.FromFileIdx, "fromFile", 0, "index of the first file to init (inclusive)")
 	var to int
 	flag.IntVar(&to, "toFile", 0,
@@ -291,13 +366,36 @@ func main() {
 		log.Fatalln("failed to initialize zap logger:", err)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	if verifyPos {
-		cmdVerifyPos(opts, fraction, logger)
-		os.Exit(0)
+		cmdVerifyPos(ctx, opts, fraction, verifyReport, verifyWorkers, verifyState, logger)
+		return
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	if repair {
+		if !flagSet["provider"] {
+			opts.ProviderID = nil
+		}
+		cmdRepair(ctx, opts, fraction, repairReport, logger)
+		return
+	}
+
+	if verifyProof != "" {
+		cmdVerifyProof(verifyProof, verifyProofMode, verifyProofIndex, verifyProofK3, logger)
+		return
+	}
+
+	if inspectProof != "" {
+		cmdInspectProof(ctx, inspectProof, opts.DataDir, logger)
+		return
+	}
+
+	if serve != "" {
+		cmdServe(ctx, serve, cfg, serveDatadirs, opts.DataDir, logger)
+		return
+	}
 
 	if searchForNonce {
 		nonce, label, err := initialization.SearchForNonce(
@@ -332,13 +430,25 @@ func main() {
 		log.Fatalf("failed to decode commitmentAtxId %s: %s\n", commitmentAtxIdHex, err)
 	}
 
-	init, err := initialization.NewInitializer(
+	initOpts := []initialization.OptionFunc{
 		initialization.WithConfig(cfg),
 		initialization.WithInitOpts(opts),
 		initialization.WithNodeId(id),
 		initialization.WithCommitmentAtxId(commitmentAtxId),
 		initialization.WithLogger(logger),
-	)
+	}
+	if flagSet["batchLatency"] {
+		initOpts = append(initOpts, initialization.WithAdaptiveBatchSize(batchLatency, batchMaxMemory))
+	}
+	if flagSet["schedule"] {
+		s, err := initialization.ParseSchedule(schedule)
+		if err != nil {
+			log.Fatalf("invalid schedule %s: %s\n", schedule, err)
+		}
+		initOpts = append(initOpts, initialization.WithSchedule(s))
+	}
+
+	init, err := initialization.NewInitializer(initOpts...)
 	if err != nil {
 		log.Panic(err.Error())
 	}
@@ -364,37 +474,53 @@ func main() {
 	log.Println("cli: initialization completed")
 
 	if genProof {
+		challenge, err := parseChallenge(challengeHex)
+		if err != nil {
+			log.Fatalf("invalid challenge %s: %s\n", challengeHex, err)
+		}
+
 		log.Println("cli: generating proof as a sanity test")
 
 		proof, proofMetadata, err := proving.Generate(
 			ctx,
-			shared.ZeroChallenge,
+			challenge,
 			cfg,
 			logger,
 			proving.WithDataSource(cfg, id, commitmentAtxId, opts.DataDir),
+			proving.WithSelfVerification(proving.VerifyAllIndices(), opts.Scrypt),
 		)
-		if err != nil {
+		var errInvalidProof proving.InvalidProofError
+		switch {
+		case errors.As(err, &errInvalidProof):
+			// keep the invalid proof so it can be inspected with -inspectProof
+			if proofFile != "" {
+				saveProof(proofFile, errInvalidProof.Proof, errInvalidProof.Metadata)
+			}
+			log.Fatalln("failed to verify test proof", err)
+		case err != nil:
 			log.Fatalln("proof generation error", err)
 		}
-		verifier, err := verifying.NewProofVerifier()
-		if err != nil {
-			log.Fatalln("failed to create verifier", err)
-		}
-		defer verifier.Close()
-		err = verifier.Verify(
-			proof,
-			proofMetadata,
-			cfg,
-			logger,
-			verifying.WithLabelScryptParams(opts.Scrypt),
-			verifying.AllIndices(),
-		)
-		if err != nil {
-			log.Fatalln("failed to verify test proof", err)
+
+		log.Printf("cli: proof %x is valid\n", proof.Hash())
+
+		if proofFile != "" {
+			saveProof(proofFile, proof, proofMetadata)
 		}
+	}
+}
 
-		log.Println("cli: proof is valid")
+// saveProof writes `proof` to `proofFile` for -verifyProof and -inspectProof.
+func saveProof(proofFile string, proof *shared.Proof, metadata *shared.ProofMetadata) {
+	err := writeProofFile(proofFile, &proofDocument{
+		Proof:    *proof,
+		Metadata: *metadata,
+		Config:   newProofConfig(cfg),
+		Scrypt:   opts.Scrypt,
+	})
+	if err != nil {
+		log.Fatalln("failed to write proof", err)
 	}
+	log.Println("cli: proof written to", proofFile)
 }
 
 func saveKey(key ed25519.PrivateKey) error {
@@ -434,7 +560,15 @@ func loadKey() (ed25519.PublicKey, error) {
 	return ed25519.NewKeyFromSeed(dst[:ed25519.SeedSize]).Public().(ed25519.PublicKey), nil
 }
 
-func cmdVerifyPos(opts config.InitOpts, fraction float64, logger *zap.Logger) {
+func cmdVerifyPos(
+	ctx context.Context,
+	opts config.InitOpts,
+	fraction float64,
+	report bool,
+	workers int,
+	stateFile string,
+	logger *zap.Logger,
+) {
 	log.Println("cli: verifying", edKeyFileName)
 	pub, err := loadKey()
 	switch {
@@ -459,24 +593,168 @@ func cmdVerifyPos(opts config.InitOpts, fraction float64, logger *zap.Logger) {
 		log.Println("cli:", edKeyFileName, "is valid")
 	}
 
+	if report {
+		cmdScanPos(ctx, opts, fraction, logger)
+		return
+	}
+
+	verifyPosFiles(ctx, opts, fraction, workers, stateFile, logger)
+}
+
+func verifyPosFiles(
+	ctx context.Context,
+	opts config.InitOpts,
+	fraction float64,
+	workers int,
+	stateFile string,
+	logger *zap.Logger,
+) {
 	log.Println("cli: verifying POS data")
-	params := postrs.NewScryptParams(opts.Scrypt.N, opts.Scrypt.R, opts.Scrypt.P)
-	verifyOpts := []postrs.VerifyPosOptionsFunc{
-		postrs.WithFraction(fraction),
-		postrs.FromFile(uint32(opts.FromFileIdx)),
-		postrs.VerifyPosWithLogger(logger),
+	report, err := initialization.VerifyPos(ctx, opts,
+		initialization.VerifyPosWithFraction(fraction),
+		initialization.VerifyPosWithWorkers(workers),
+		initialization.VerifyPosWithStateFile(stateFile),
+		initialization.VerifyPosWithLogger(logger),
+		initialization.VerifyPosWithProgress(printVerifyPosProgress(time.Now())),
+	)
+	if report != nil && len(report.Files) > 0 {
+		fmt.Fprintln(os.Stderr)
 	}
-	if opts.ToFileIdx != nil {
-		verifyOpts = append(verifyOpts, postrs.ToFile(uint32(*opts.ToFileIdx)))
+	switch {
+	case errors.Is(err, context.Canceled):
+		if stateFile != "" {
+			log.Fatalf("cli: verification interrupted after %d of %d files, run again with -verifyState %s to resume\n",
+				len(report.Files), report.Total, stateFile,
+			)
+		}
+		log.Fatalf("cli: verification interrupted after %d of %d files\n", len(report.Files), report.Total)
+	case err != nil:
+		log.Fatalf("cli: failed (%v)\n", err)
 	}
 
-	err = postrs.VerifyPos(opts.DataDir, params, verifyOpts...)
+	var invalid, failed int
+	for _, f := range report.Failed() {
+		log.Printf("cli: %s: %v\n", shared.InitFileName(f.FileIndex), f.Err)
+		if errors.Is(f.Err, initialization.ErrInvalidPos) {
+			invalid++
+		} else {
+			failed++
+		}
+	}
+	log.Printf("cli: verified %d files in %s: %d valid, %d invalid, %d failed to verify\n",
+		len(report.Files), report.Duration.Round(time.Second), len(report.Files)-invalid-failed, invalid, failed,
+	)
 	switch {
-	case err == nil:
-		log.Println("cli: POS data is valid")
-	case errors.Is(err, postrs.ErrInvalidPos):
-		log.Fatalf("cli: %v\n", err)
-	default:
+	case invalid > 0:
+		log.Fatalln("cli: POS data is invalid")
+	case failed > 0:
+		log.Fatalln("cli: failed to verify POS data")
+	}
+	log.Println("cli: POS data is valid")
+}
+
+// printVerifyPosProgress returns a progress callback for initialization.VerifyPos that keeps a progress line
+// updated on stderr.
+func printVerifyPosProgress(start time.Time) func(initialization.VerifyPosProgress) {
+	// files verified in this run, without the files of a previous run
+	verified := 0
+	return func(p initialization.VerifyPosProgress) {
+		elapsed := time.Since(start)
+		line := fmt.Sprintf("cli: verified %d/%d files (%.1f%%), %d failed, elapsed %s",
+			p.Verified, p.Total, float64(p.Verified)*100/float64(p.Total), p.Failed, elapsed.Round(time.Second),
+		)
+		if !p.Result.Resumed {
+			verified++
+		}
+		if p.Verified < p.Total && verified > 0 {
+			remaining := elapsed / time.Duration(verified) * time.Duration(p.Total-p.Verified)
+			line += fmt.Sprintf(", ~%s left", remaining.Round(time.Second))
+		}
+		// pad the line to overwrite a longer previous one
+		fmt.Fprintf(os.Stderr, "\r%-100s", line)
+	}
+}
+
+func cmdScanPos(ctx context.Context, opts config.InitOpts, fraction float64, logger *zap.Logger) {
+	log.Println("cli: scanning POS data for invalid labels")
+	report, err := initialization.ScanPos(ctx, opts,
+		initialization.ScanWithFraction(fraction),
+		initialization.ScanWithLogger(logger),
+	)
+	if err != nil {
 		log.Fatalf("cli: failed (%v)\n", err)
 	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("cli: failed to encode report: %v\n", err)
+	}
+
+	if !report.Valid() {
+		var invalid uint64
+		for _, f := range report.Files {
+			invalid += f.Invalid
+		}
+		log.Fatalf("cli: POS data is invalid: found %d invalid labels in %d ranges\n",
+			invalid, len(report.InvalidRanges()),
+		)
+	}
+	log.Println("cli: POS data is valid")
+}
+
+func cmdRepair(ctx context.Context, opts config.InitOpts, fraction float64, reportFile string, logger *zap.Logger) {
+	report := &initialization.PosReport{}
+	if reportFile != "" {
+		data, err := os.ReadFile(reportFile)
+		if err != nil {
+			log.Fatalf("cli: could not read report from %s: %v\n", reportFile, err)
+		}
+		if err := json.Unmarshal(data, report); err != nil {
+			log.Fatalf("cli: failed to decode report from %s: %v\n", reportFile, err)
+		}
+	} else {
+		log.Println("cli: scanning POS data for invalid labels")
+		var err error
+		report, err = initialization.ScanPos(ctx, opts,
+			initialization.ScanWithFraction(fraction),
+			initialization.ScanWithLogger(logger),
+		)
+		if err != nil {
+			log.Fatalf("cli: failed (%v)\n", err)
+		}
+	}
+
+	// labels outside the sampled blocks weren't verified, invalid labels among them aren't repaired
+	sampled := "all labels"
+	if report.Fraction < 100 {
+		sampled = fmt.Sprintf("the %v%% of labels sampled", report.Fraction)
+	}
+	ranges := report.InvalidRanges()
+	if len(ranges) == 0 {
+		log.Printf("cli: no invalid labels to repair among %s\n", sampled)
+		return
+	}
+	var invalid uint64
+	for _, r := range ranges {
+		invalid += r.Len()
+	}
+	log.Printf("cli: repairing %d labels in %d ranges in %s\n", invalid, len(ranges), opts.DataDir)
+	if report.Fraction < 100 {
+		log.Printf("cli: WARNING: only %s were verified, invalid labels that weren't sampled are NOT repaired. "+
+			"Verify the data again after the repair or scan all labels with -fraction 100\n", sampled)
+	}
+	askForConfirmation()
+
+	result, err := initialization.Repair(ctx, opts, ranges, initialization.RepairWithLogger(logger))
+	switch {
+	case err != nil && result != nil:
+		log.Fatalf("cli: repair failed after %d labels: %v\n", result.Repaired, err)
+	case err != nil:
+		log.Fatalf("cli: repair failed: %v\n", err)
+	}
+	if result.Nonce != nil {
+		log.Printf("cli: found new best nonce. Nonce: %d | Label: %X\n", *result.Nonce, result.NonceValue)
+	}
+	log.Printf("cli: repaired %d invalid labels found among %s\n", result.Repaired, sampled)
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/proving"
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+// proofDocument is the content of a file written by -genproof with -proofFile. It contains everything needed
+// to verify the proof with -verifyProof on another machine.
+type proofDocument struct {
+	Proof    shared.Proof
+	Metadata shared.ProofMetadata
+	Config   proofConfig
+	Scrypt   config.ScryptParams
+}
+
+// proofConfig is the config a proof was generated with.
+type proofConfig struct {
+	MinNumUnits   uint32
+	MaxNumUnits   uint32
+	LabelsPerUnit uint64
+	K1            uint
+	K2            uint
+	PowDifficulty shared.HexBytes
+}
+
+func newProofConfig(cfg config.Config) proofConfig {
+	return proofConfig{
+		MinNumUnits:   cfg.MinNumUnits,
+		MaxNumUnits:   cfg.MaxNumUnits,
+		LabelsPerUnit: cfg.LabelsPerUnit,
+		K1:            cfg.K1,
+		K2:            cfg.K2,
+		PowDifficulty: cfg.PowDifficulty[:],
+	}
+}
+
+func (c proofConfig) config() (config.Config, error) {
+	cfg := config.Config{
+		MinNumUnits:   c.MinNumUnits,
+		MaxNumUnits:   c.MaxNumUnits,
+		LabelsPerUnit: c.LabelsPerUnit,
+		K1:            c.K1,
+		K2:            c.K2,
+	}
+	if len(c.PowDifficulty) != len(cfg.PowDifficulty) {
+		return config.Config{}, fmt.Errorf("invalid `PowDifficulty` length; expected: %d, given: %d",
+			len(cfg.PowDifficulty), len(c.PowDifficulty),
+		)
+	}
+	copy(cfg.PowDifficulty[:], c.PowDifficulty)
+	return cfg, nil
+}
+
+func writeProofFile(path string, pf *proofDocument) error {
+	data, err := json.MarshalIndent(pf, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode proof: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("proof write to disk error: %w", err)
+	}
+	return nil
+}
+
+func readProofFile(path string) (*proofDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read proof from %s: %w", path, err)
+	}
+
+	pf := &proofDocument{}
+	if err := json.Unmarshal(data, pf); err != nil {
+		return nil, fmt.Errorf("failed to decode proof from %s: %w", path, err)
+	}
+	return pf, nil
+}
+
+func parseChallenge(challengeHex string) (shared.Challenge, error) {
+	challenge, err := hex.DecodeString(challengeHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(challenge) != 32 {
+		return nil, fmt.Errorf("invalid challenge length; expected: 32, given: %d", len(challenge))
+	}
+	return challenge, nil
+}
+
+func cmdVerifyProof(path, mode string, index int, k3 uint, logger *zap.Logger) {
+	if err := verifyProofFile(path, mode, index, k3, logger); err != nil {
+		log.Fatalf("cli: %v\n", err)
+	}
+	log.Println("cli: proof is valid")
+}
+
+// verifyProofFile verifies the proof in the file at `path`. `mode` is one of all, subset or index.
+func verifyProofFile(path, mode string, index int, k3 uint, logger *zap.Logger) error {
+	pf, err := readProofFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := pf.Config.config()
+	if err != nil {
+		return fmt.Errorf("invalid config in %s: %w", path, err)
+	}
+
+	var verifyOpt verifying.OptionFunc
+	switch mode {
+	case "all":
+		verifyOpt = verifying.AllIndices()
+	case "subset":
+		if k3 == 0 {
+			k3 = cfg.K2
+		}
+		verifyOpt = verifying.Subset(k3, pf.Metadata.NodeId)
+	case "index":
+		verifyOpt = verifying.SelectedIndex(index)
+	default:
+		return fmt.Errorf("invalid verification mode %q; expected: all, subset or index", mode)
+	}
+
+	hash := pf.Proof.Hash()
+	log.Printf("cli: verifying proof %x (mode: %s)\n", hash, mode)
+
+	verifier, err := verifying.NewProofVerifier()
+	if err != nil {
+		return fmt.Errorf("failed to create verifier: %w", err)
+	}
+	defer verifier.Close()
+
+	err = verifier.Verify(
+		&pf.Proof,
+		&pf.Metadata,
+		cfg,
+		logger,
+		verifying.WithLabelScryptParams(pf.Scrypt),
+		verifyOpt,
+	)
+	if err != nil {
+		return fmt.Errorf("proof is invalid: %w", err)
+	}
+	return nil
+}
+
+func cmdInspectProof(ctx context.Context, path, datadir string, logger *zap.Logger) {
+	pf, err := readProofFile(path)
+	if err != nil {
+		log.Fatalf("cli: %v\n", err)
+	}
+	cfg, err := pf.Config.config()
+	if err != nil {
+		log.Fatalf("cli: invalid config in %s: %v\n", path, err)
+	}
+
+	hash := pf.Proof.Hash()
+	log.Printf("cli: inspecting proof %x against %s\n", hash, datadir)
+
+	report, err := proving.InspectProof(ctx, &pf.Proof, &pf.Metadata, cfg, datadir, pf.Scrypt, logger)
+	if err != nil {
+		log.Fatalf("cli: failed to inspect proof: %v\n", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tFILE\tOFFSET\tSTORED\tEXPECTED\tMATCH")
+	for _, r := range report.Indices {
+		stored := hex.EncodeToString(r.Stored)
+		if r.Error != "" {
+			stored = r.Error
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%x\t%t\n", r.Index, r.File(), r.Offset, stored, r.Expected, r.Match)
+	}
+	w.Flush()
+
+	if mismatches := report.Mismatches(); len(mismatches) > 0 {
+		log.Fatalf("cli: %d of %d labels don't match\n", len(mismatches), len(report.Indices))
+	}
+	log.Println("cli: all labels match")
+}
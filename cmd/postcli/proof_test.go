@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/proving"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestProofFile_RoundTrip(t *testing.T) {
+	cfg := config.DefaultConfig()
+	pf := &proofDocument{
+		Proof: shared.Proof{Nonce: 7, Indices: []byte{1, 2, 3, 4}, Pow: 42},
+		Metadata: shared.ProofMetadata{
+			NodeId:          make([]byte, 32),
+			CommitmentAtxId: make([]byte, 32),
+			Challenge:       make([]byte, 32),
+			NumUnits:        2,
+			LabelsPerUnit:   cfg.LabelsPerUnit,
+		},
+		Config: newProofConfig(cfg),
+		Scrypt: config.ScryptParams{N: 16, R: 1, P: 1},
+	}
+	path := filepath.Join(t.TempDir(), "proof.json")
+	require.NoError(t, writeProofFile(path, pf))
+
+	read, err := readProofFile(path)
+	require.NoError(t, err)
+	require.Equal(t, pf, read)
+
+	readCfg, err := read.Config.config()
+	require.NoError(t, err)
+	require.Equal(t, cfg.K1, readCfg.K1)
+	require.Equal(t, cfg.K2, readCfg.K2)
+	require.Equal(t, cfg.LabelsPerUnit, readCfg.LabelsPerUnit)
+	require.Equal(t, cfg.PowDifficulty, readCfg.PowDifficulty)
+}
+
+func TestReadProofFile_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := readProofFile(filepath.Join(dir, "missing.json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(dir, "proof.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err = readProofFile(path)
+	require.ErrorContains(t, err, "failed to decode proof")
+}
+
+func TestVerifyProofFile(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	cfg := config.DefaultConfig()
+	initOpts := config.DefaultInitOpts()
+	initOpts.Scrypt.N = 16 // speed up initialization
+	initOpts.DataDir = t.TempDir()
+	initOpts.NumUnits = cfg.MinNumUnits
+	initOpts.ProviderID = new(uint32)
+	*initOpts.ProviderID = postrs.CPUProviderID()
+	initOpts.ComputeBatchSize = 1 << 14
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(initOpts),
+		initialization.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	proof, metadata, err := proving.Generate(
+		context.Background(),
+		make(shared.Challenge, 32),
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, initOpts.DataDir),
+		proving.LightMode(),
+	)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "proof.json")
+	pf := &proofDocument{
+		Proof:    *proof,
+		Metadata: *metadata,
+		Config:   newProofConfig(cfg),
+		Scrypt:   initOpts.Scrypt,
+	}
+	require.NoError(t, writeProofFile(path, pf))
+
+	require.NoError(t, verifyProofFile(path, "all", 0, 0, logger))
+	require.NoError(t, verifyProofFile(path, "subset", 0, 2, logger))
+	require.NoError(t, verifyProofFile(path, "index", 1, 0, logger))
+	require.ErrorContains(t, verifyProofFile(path, "some", 0, 0, logger), "invalid verification mode")
+
+	pf.Proof.Pow++
+	require.NoError(t, writeProofFile(path, pf))
+	require.ErrorContains(t, verifyProofFile(path, "all", 0, 0, logger), "proof is invalid")
+}
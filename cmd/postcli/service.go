@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/proving/service"
+)
+
+// serveShutdownTimeout is how long cmdServe waits for running requests after it was interrupted.
+const serveShutdownTimeout = 5 * time.Second
+
+// datadirsFlag collects the data directories passed with -serveDatadir as "name=path".
+type datadirsFlag []datadirFlag
+
+type datadirFlag struct {
+	name, path string
+}
+
+func (f *datadirsFlag) String() string {
+	s := make([]string, 0, len(*f))
+	for _, d := range *f {
+		s = append(s, d.name+"="+d.path)
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *datadirsFlag) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("invalid datadir %q; expected: name=path", value)
+	}
+	*f = append(*f, datadirFlag{name: name, path: path})
+	return nil
+}
+
+// cmdServe serves proof generation for `datadirs` over HTTP on `addr` until `ctx` is canceled. Without `datadirs`
+// the data directory `datadir` is served under its base name.
+func cmdServe(
+	ctx context.Context,
+	addr string,
+	cfg config.Config,
+	datadirs datadirsFlag,
+	datadir string,
+	logger *zap.Logger,
+) {
+	if len(datadirs) == 0 {
+		datadirs = datadirsFlag{{name: filepath.Base(datadir), path: datadir}}
+	}
+	opts := []service.OptionFunc{
+		service.WithConfig(cfg),
+		service.WithLogger(logger),
+	}
+	for _, d := range datadirs {
+		opts = append(opts, service.WithDatadir(d.name, d.path))
+	}
+	s, err := service.NewServer(opts...)
+	if err != nil {
+		log.Fatalf("cli: failed to create proof service: %v\n", err)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("cli: serving proofs for %s on %s\n", strings.Join(s.Datadirs(), ", "), addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("cli: proof service failed: %v\n", err)
+	}
+	log.Println("cli: proof service stopped")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatadirsFlag(t *testing.T) {
+	var datadirs datadirsFlag
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&datadirs, "serveDatadir", "")
+
+	require.NoError(t, fs.Parse([]string{"-serveDatadir", "a=/data/a", "-serveDatadir", "b=/data/b=1"}))
+	require.Equal(t, datadirsFlag{{name: "a", path: "/data/a"}, {name: "b", path: "/data/b=1"}}, datadirs)
+	require.Equal(t, "a=/data/a,b=/data/b=1", datadirs.String())
+
+	for _, value := range []string{"a", "=/data/a", "a="} {
+		require.ErrorContains(t, datadirs.Set(value), "expected: name=path", value)
+	}
+}
@@ -0,0 +1,55 @@
+package initialization
+
+import (
+	"math"
+	"time"
+
+	"github.com/spacemeshos/post/internal/postrs"
+)
+
+const (
+	// DefaultBatchLatencyTarget is the default time computing a single batch of labels should take
+	// when the compute batch size is tuned automatically.
+	DefaultBatchLatencyTarget = 5 * time.Second
+
+	// DefaultBatchMaxMemory is the default limit for the size of the buffer holding a batch of labels
+	// when the compute batch size is tuned automatically.
+	DefaultBatchMaxMemory = 256 * 1024 * 1024
+
+	// minAdaptiveBatchSize is the batch size the automatic tuning starts with.
+	minAdaptiveBatchSize = 1 << 10
+)
+
+// batchSizeTuner adapts the number of labels computed per batch, such that computing a batch
+// takes roughly `target` while the buffer holding the batch stays within the memory limit.
+type batchSizeTuner struct {
+	target  time.Duration
+	minSize uint64
+	maxSize uint64
+
+	size uint64
+}
+
+func newBatchSizeTuner(target time.Duration, maxMemory uint64) *batchSizeTuner {
+	return &batchSizeTuner{
+		target:  target,
+		minSize: minAdaptiveBatchSize,
+		maxSize: maxMemory / postrs.LabelLength,
+		size:    minAdaptiveBatchSize,
+	}
+}
+
+// observe records that computing `numLabels` labels took `elapsed` and returns the batch size to use next.
+func (t *batchSizeTuner) observe(numLabels uint64, elapsed time.Duration) uint64 {
+	if numLabels == 0 || elapsed <= 0 {
+		return t.size
+	}
+
+	// number of labels that can be computed within the target latency with the measured throughput.
+	ideal := float64(numLabels) * float64(t.target) / float64(elapsed)
+
+	// change the batch size at most by a factor of 2 per batch to smooth out noisy measurements.
+	ideal = math.Min(math.Max(ideal, float64(t.size)/2), float64(t.size)*2)
+	t.size = min(max(uint64(ideal), t.minSize), t.maxSize)
+	return t.size
+}
@@ -0,0 +1,54 @@
+package initialization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/internal/postrs"
+)
+
+func TestBatchSizeTuner_Converges(t *testing.T) {
+	const labelsPerSecond = 100_000
+	target := 2 * time.Second
+
+	tuner := newBatchSizeTuner(target, DefaultBatchMaxMemory)
+	size := tuner.size
+	require.EqualValues(t, minAdaptiveBatchSize, size)
+
+	for i := 0; i < 20; i++ {
+		elapsed := time.Duration(size) * time.Second / labelsPerSecond
+		size = tuner.observe(size, elapsed)
+	}
+	require.InDelta(t, labelsPerSecond*target.Seconds(), float64(size), 1)
+}
+
+func TestBatchSizeTuner_GrowsAtMostTwice(t *testing.T) {
+	tuner := newBatchSizeTuner(time.Second, DefaultBatchMaxMemory)
+	require.EqualValues(t, 2*minAdaptiveBatchSize, tuner.observe(minAdaptiveBatchSize, time.Microsecond))
+	require.EqualValues(t, minAdaptiveBatchSize, tuner.observe(2*minAdaptiveBatchSize, time.Hour))
+}
+
+func TestBatchSizeTuner_Bounds(t *testing.T) {
+	maxMemory := uint64(4 * minAdaptiveBatchSize * postrs.LabelLength)
+	tuner := newBatchSizeTuner(time.Second, maxMemory)
+
+	// very fast provider: limited by memory
+	for i := 0; i < 10; i++ {
+		tuner.observe(tuner.size, time.Microsecond)
+	}
+	require.EqualValues(t, 4*minAdaptiveBatchSize, tuner.size)
+
+	// very slow provider: limited by minimum batch size
+	for i := 0; i < 10; i++ {
+		tuner.observe(tuner.size, time.Hour)
+	}
+	require.EqualValues(t, minAdaptiveBatchSize, tuner.size)
+}
+
+func TestBatchSizeTuner_IgnoresEmptyMeasurements(t *testing.T) {
+	tuner := newBatchSizeTuner(time.Second, DefaultBatchMaxMemory)
+	require.EqualValues(t, minAdaptiveBatchSize, tuner.observe(0, time.Second))
+	require.EqualValues(t, minAdaptiveBatchSize, tuner.observe(minAdaptiveBatchSize, 0))
+}
@@ -0,0 +1,225 @@
+package initialization
+
+import (
+	"errors"
+	"sync"
+)
+
+// Phase is a phase of the initialization reported to the hook set with OnPhaseChange.
+type Phase int
+
+const (
+	// PhaseLabelling is the phase in which the labels of the PoST data are computed and written to disk.
+	PhaseLabelling Phase = iota
+	// PhaseNonceSearch is the phase in which a nonce is searched past the labels of the PoST data,
+	// because none was found while computing them.
+	PhaseNonceSearch
+	// PhaseDone is reported when Initialize completes successfully.
+	PhaseDone
+	// PhaseWaiting is the phase in which Initialize waits for the next window of the schedule set with
+	// WithSchedule.
+	PhaseWaiting
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseLabelling:
+		return "labelling"
+	case PhaseNonceSearch:
+		return "nonce search"
+	case PhaseDone:
+		return "done"
+	case PhaseWaiting:
+		return "waiting"
+	default:
+		return "unknown"
+	}
+}
+
+// OnFileCompleted sets a hook that is called every time a file of the PoST data is completed, including files
+// that were already complete when Initialize was called. `numLabels` is the number of labels in the file.
+func OnFileCompleted(hook func(index int, numLabels uint64)) OptionFunc {
+	return func(opts *option) error {
+		if hook == nil {
+			return errors.New("file completed hook is nil")
+		}
+		opts.hooks.onFileCompleted = hook
+		return nil
+	}
+}
+
+// OnNonceFound sets a hook that is called every time a new best nonce is found. `value` is the label at
+// the position `nonce` and owned by the hook.
+func OnNonceFound(hook func(nonce uint64, value []byte)) OptionFunc {
+	return func(opts *option) error {
+		if hook == nil {
+			return errors.New("nonce found hook is nil")
+		}
+		opts.hooks.onNonceFound = hook
+		return nil
+	}
+}
+
+// OnPhaseChange sets a hook that is called when Initialize enters a new phase.
+func OnPhaseChange(hook func(phase Phase)) OptionFunc {
+	return func(opts *option) error {
+		if hook == nil {
+			return errors.New("phase change hook is nil")
+		}
+		opts.hooks.onPhaseChange = hook
+		return nil
+	}
+}
+
+// OnBatchSizeChange sets a hook that is called every time WithAdaptiveBatchSize changes the compute batch
+// size. `batchSize` is the new number of labels computed in a single batch.
+func OnBatchSizeChange(hook func(batchSize uint64)) OptionFunc {
+	return func(opts *option) error {
+		if hook == nil {
+			return errors.New("batch size change hook is nil")
+		}
+		opts.hooks.onBatchSizeChange = hook
+		return nil
+	}
+}
+
+// OnError sets a hook that is called with the error Initialize returns, unless the error is
+// ErrAlreadyInitializing.
+func OnError(hook func(err error)) OptionFunc {
+	return func(opts *option) error {
+		if hook == nil {
+			return errors.New("error hook is nil")
+		}
+		opts.hooks.onError = hook
+		return nil
+	}
+}
+
+// WithAsyncHooks calls the hooks on a separate goroutine instead of the goroutine that reached the milestone,
+// so slow hooks don't delay the initialization. Hooks are still called one at a time and in order, and
+// Initialize only returns after all hooks have returned.
+func WithAsyncHooks() OptionFunc {
+	return func(opts *option) error {
+		opts.hooks.async = true
+		return nil
+	}
+}
+
+type hooks struct {
+	onFileCompleted   func(index int, numLabels uint64)
+	onNonceFound      func(nonce uint64, value []byte)
+	onPhaseChange     func(phase Phase)
+	onBatchSizeChange func(batchSize uint64)
+	onError           func(err error)
+
+	async bool
+}
+
+// hookDispatcher calls the hooks of an Initializer. Calls are serialized, so hooks never run concurrently,
+// even when they are triggered by different goroutines during the nonce search.
+type hookDispatcher struct {
+	hooks
+
+	mtx     sync.Mutex
+	pending []func()
+	wake    chan struct{}
+	stopped chan struct{}
+}
+
+func newHookDispatcher(h hooks) *hookDispatcher {
+	return &hookDispatcher{hooks: h}
+}
+
+// start prepares the dispatcher for a call to Initialize.
+func (d *hookDispatcher) start() {
+	if !d.async {
+		return
+	}
+
+	d.wake = make(chan struct{}, 1)
+	d.stopped = make(chan struct{})
+	go d.run(d.wake, d.stopped)
+}
+
+// stop waits until all hooks triggered during a call to Initialize have returned.
+func (d *hookDispatcher) stop() {
+	if !d.async {
+		return
+	}
+
+	close(d.wake)
+	<-d.stopped
+}
+
+func (d *hookDispatcher) run(wake <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	for {
+		_, ok := <-wake
+		d.mtx.Lock()
+		pending := d.pending
+		d.pending = nil
+		d.mtx.Unlock()
+
+		for _, call := range pending {
+			call()
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func (d *hookDispatcher) dispatch(call func()) {
+	d.mtx.Lock()
+	if !d.async {
+		defer d.mtx.Unlock()
+		call()
+		return
+	}
+
+	d.pending = append(d.pending, call)
+	d.mtx.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+		// the dispatcher was already woken up
+	}
+}
+
+func (d *hookDispatcher) fileCompleted(index int, numLabels uint64) {
+	if d.onFileCompleted == nil {
+		return
+	}
+	d.dispatch(func() { d.onFileCompleted(index, numLabels) })
+}
+
+func (d *hookDispatcher) nonceFound(nonce uint64, value []byte) {
+	if d.onNonceFound == nil {
+		return
+	}
+	v := make([]byte, len(value))
+	copy(v, value)
+	d.dispatch(func() { d.onNonceFound(nonce, v) })
+}
+
+func (d *hookDispatcher) phaseChanged(phase Phase) {
+	if d.onPhaseChange == nil {
+		return
+	}
+	d.dispatch(func() { d.onPhaseChange(phase) })
+}
+
+func (d *hookDispatcher) batchSizeChanged(batchSize uint64) {
+	if d.onBatchSizeChange == nil {
+		return
+	}
+	d.dispatch(func() { d.onBatchSizeChange(batchSize) })
+}
+
+func (d *hookDispatcher) failed(err error) {
+	if d.onError == nil {
+		return
+	}
+	d.dispatch(func() { d.onError(err) })
+}
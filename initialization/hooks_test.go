@@ -0,0 +1,225 @@
+package initialization
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+type fileCompleted struct {
+	index     int
+	numLabels uint64
+}
+
+type nonceFound struct {
+	nonce uint64
+	value []byte
+}
+
+// hookRecorder records the calls of all hooks and fails the test if hooks are called concurrently.
+type hookRecorder struct {
+	tb testing.TB
+
+	running sync.Mutex
+	mtx     sync.Mutex
+
+	files  []fileCompleted
+	nonces []nonceFound
+	phases []Phase
+	errors []error
+}
+
+func (r *hookRecorder) enter() func() {
+	if !r.running.TryLock() {
+		r.tb.Error("hooks called concurrently")
+		return func() {}
+	}
+	return r.running.Unlock
+}
+
+func (r *hookRecorder) options() []OptionFunc {
+	return []OptionFunc{
+		OnFileCompleted(func(index int, numLabels uint64) {
+			defer r.enter()()
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+			r.files = append(r.files, fileCompleted{index, numLabels})
+		}),
+		OnNonceFound(func(nonce uint64, value []byte) {
+			defer r.enter()()
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+			r.nonces = append(r.nonces, nonceFound{nonce, value})
+		}),
+		OnPhaseChange(func(phase Phase) {
+			defer r.enter()()
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+			r.phases = append(r.phases, phase)
+		}),
+		OnError(func(err error) {
+			defer r.enter()()
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+			r.errors = append(r.errors, err)
+		}),
+	}
+}
+
+func TestInitialize_Hooks(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		async := async
+		name := "sync"
+		if async {
+			name = "async"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			cfg, opts := getTestConfig(t)
+			opts.NumUnits = 4
+			opts.MaxFileSize = cfg.UnitSize()
+
+			rec := &hookRecorder{tb: t}
+			initOpts := append([]OptionFunc{
+				WithNodeId(nodeId),
+				WithCommitmentAtxId(commitmentAtxId),
+				WithConfig(cfg),
+				WithInitOpts(opts),
+				WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+			}, rec.options()...)
+			if async {
+				initOpts = append(initOpts, WithAsyncHooks())
+			}
+
+			init, err := NewInitializer(initOpts...)
+			require.NoError(t, err)
+			require.NoError(t, init.Initialize(context.Background()))
+
+			// all hooks have returned when Initialize returns
+			require.Equal(t, []Phase{PhaseLabelling, PhaseDone}, rec.phases)
+			require.Equal(t, []fileCompleted{
+				{0, cfg.LabelsPerUnit},
+				{1, cfg.LabelsPerUnit},
+				{2, cfg.LabelsPerUnit},
+				{3, cfg.LabelsPerUnit},
+			}, rec.files)
+			require.Empty(t, rec.errors)
+
+			require.NotEmpty(t, rec.nonces)
+			last := rec.nonces[len(rec.nonces)-1]
+			require.Equal(t, *init.Nonce(), last.nonce)
+			require.Equal(t, init.NonceValue(), last.value)
+			for i := 1; i < len(rec.nonces); i++ {
+				require.Negative(t, new(big.Int).SetBytes(rec.nonces[i].value).Cmp(
+					new(big.Int).SetBytes(rec.nonces[i-1].value),
+				), "every reported nonce is better than the previous one")
+			}
+		})
+	}
+}
+
+func TestInitialize_Hooks_NonceSearch(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	numLabels := uint64(opts.NumUnits) * cfg.LabelsPerUnit
+
+	rec := &hookRecorder{tb: t}
+	init, err := NewInitializer(append([]OptionFunc{
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithNonceSearchProviders(CPUProviderID(), CPUProviderID()),
+		WithAsyncHooks(),
+		// use a higher difficulty to make sure no Pow is found in the first `numLabels` labels.
+		withDifficultyFunc(func(numLabels uint64) []byte {
+			x := new(big.Int).Lsh(big.NewInt(1), 256)
+			x.Div(x, big.NewInt(int64(numLabels)))
+			x.Div(x, big.NewInt(1024))
+
+			difficulty := make([]byte, 32)
+			return x.FillBytes(difficulty)
+		}),
+	}, rec.options()...)...)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	require.Equal(t, []Phase{PhaseLabelling, PhaseNonceSearch, PhaseDone}, rec.phases)
+	require.Len(t, rec.nonces, 1)
+	require.GreaterOrEqual(t, rec.nonces[0].nonce, numLabels)
+	require.Equal(t, *init.Nonce(), rec.nonces[0].nonce)
+	require.Equal(t, init.NonceValue(), rec.nonces[0].value)
+}
+
+func TestInitialize_Hooks_Error(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+
+	rec := &hookRecorder{tb: t}
+	init, err := NewInitializer(append([]OptionFunc{
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	}, rec.options()...)...)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, init.Initialize(ctx), context.Canceled)
+
+	require.Equal(t, []Phase{PhaseLabelling}, rec.phases)
+	require.Len(t, rec.errors, 1)
+	require.ErrorIs(t, rec.errors[0], context.Canceled)
+}
+
+func TestInitialize_Hooks_CanQueryInitializer(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+
+	var init *Initializer
+	var statuses []Status
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		OnNonceFound(func(nonce uint64, value []byte) {
+			require.Equal(t, nonce, *init.Nonce())
+			require.Equal(t, value, init.NonceValue())
+		}),
+		OnPhaseChange(func(phase Phase) {
+			statuses = append(statuses, init.Status())
+			require.ErrorIs(t, init.Initialize(context.Background()), ErrAlreadyInitializing)
+		}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+	require.Equal(t, []Status{StatusInitializing, StatusInitializing}, statuses)
+}
+
+func TestHooks_Nil(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+
+	for _, opt := range []OptionFunc{
+		OnFileCompleted(nil),
+		OnNonceFound(nil),
+		OnPhaseChange(nil),
+		OnBatchSizeChange(nil),
+		OnError(nil),
+	} {
+		_, err := NewInitializer(
+			WithNodeId(nodeId),
+			WithCommitmentAtxId(commitmentAtxId),
+			WithConfig(cfg),
+			WithInitOpts(opts),
+			opt,
+		)
+		require.ErrorContains(t, err, "hook is nil")
+	}
+}
@@ -6,12 +6,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -62,6 +62,16 @@ type option struct {
 	logger            *Logger
 	powDifficultyFunc func(uint64) []byte
 	referenceOracle   *oracle.WorkOracle
+
+	batchTuner *batchSizeTuner
+
+	nonceSearchProviders []uint32
+	nonceSearchBudget    nonceSearchBudget
+
+	hooks hooks
+
+	schedule *Schedule
+	clock    Clock
 }
 
 func (o *option) validate() error {
@@ -83,9 +93,36 @@ func (o *option) validate() error {
 		return errors.New("no init options provided")
 	}
 
+	if err := o.validateNonceSearchProviders(); err != nil {
+		return err
+	}
+
 	return config.Validate(*o.cfg, *o.initOpts)
 }
 
+// validateNonceSearchProviders checks that the workers searching for a nonce don't need to use more than one
+// OpenCL provider. Access to OpenCL providers is serialized, so the workers would otherwise block each other.
+func (o *option) validateNonceSearchProviders() error {
+	var openCLProvider *uint32
+	if o.initOpts.ProviderID != nil && *o.initOpts.ProviderID != CPUProviderID() {
+		openCLProvider = o.initOpts.ProviderID
+	}
+
+	for _, id := range o.nonceSearchProviders {
+		id := id
+		switch {
+		case id == CPUProviderID():
+		case openCLProvider == nil:
+			openCLProvider = &id
+		case *openCLProvider != id:
+			return fmt.Errorf("invalid nonce search provider %d: only one OpenCL provider (%d) can be used",
+				id, *openCLProvider,
+			)
+		}
+	}
+	return nil
+}
+
 type OptionFunc func(*option) error
 
 // WithNodeId sets the ID of the Node.
@@ -136,6 +173,89 @@ func WithLogger(logger *zap.Logger) OptionFunc {
 	}
 }
 
+// WithAdaptiveBatchSize enables automatic tuning of the compute batch size.
+// Instead of using `InitOpts.ComputeBatchSize` for every batch, the initializer starts with a small batch
+// and measures how long computing it takes. It then converges on a batch size that can be computed within
+// `latencyTarget` while the buffer holding a batch doesn't exceed `maxMemory` bytes.
+//
+// DefaultBatchLatencyTarget and DefaultBatchMaxMemory are sensible defaults for most providers. Changes of the
+// batch size are reported to the hook set with OnBatchSizeChange.
+func WithAdaptiveBatchSize(latencyTarget time.Duration, maxMemory uint64) OptionFunc {
+	return func(opts *option) error {
+		if latencyTarget <= 0 {
+			return fmt.Errorf("invalid `latencyTarget`; expected: > 0, given: %v", latencyTarget)
+		}
+		if maxMemory < minAdaptiveBatchSize*postrs.LabelLength {
+			return fmt.Errorf("invalid `maxMemory`; expected: >= %d, given: %d",
+				minAdaptiveBatchSize*postrs.LabelLength, maxMemory,
+			)
+		}
+
+		opts.batchTuner = newBatchSizeTuner(latencyTarget, maxMemory)
+		return nil
+	}
+}
+
+// WithNonceSearchProviders sets the compute providers used to search for a nonce if none was found while
+// computing the labels of the PoST data. Every entry starts a worker that searches its share of the positions,
+// so the CPU provider can be listed multiple times. At most one OpenCL provider can be used, and if
+// `InitOpts.ProviderID` is an OpenCL provider it has to be that one.
+//
+// By default a single worker uses the provider set in `InitOpts.ProviderID`.
+func WithNonceSearchProviders(ids ...uint32) OptionFunc {
+	return func(opts *option) error {
+		if len(ids) == 0 {
+			return errors.New("at least one nonce search provider is required")
+		}
+
+		opts.nonceSearchProviders = ids
+		return nil
+	}
+}
+
+// WithNonceSearchBudget limits the search for a nonce past the labels of the PoST data within a single call to
+// Initialize to `maxDuration` and `maxPositions` positions. A zero value means no limit.
+// If no nonce is found within the budget Initialize returns ErrNonceSearchBudgetExceeded and continues the search
+// where it stopped when called again.
+func WithNonceSearchBudget(maxDuration time.Duration, maxPositions uint64) OptionFunc {
+	return func(opts *option) error {
+		if maxDuration < 0 {
+			return fmt.Errorf("invalid `maxDuration`; expected: >= 0, given: %v", maxDuration)
+		}
+
+		opts.nonceSearchBudget = nonceSearchBudget{
+			maxDuration:  maxDuration,
+			maxPositions: maxPositions,
+		}
+		return nil
+	}
+}
+
+// WithSchedule restricts the computation of labels and the search for a nonce to the windows of the schedule.
+// When a window ends the work oracles are closed, releasing the compute provider, and Initialize waits for the
+// next window to continue where it stopped.
+func WithSchedule(schedule *Schedule) OptionFunc {
+	return func(opts *option) error {
+		if schedule == nil {
+			return errors.New("schedule is nil")
+		}
+		opts.schedule = schedule
+		return nil
+	}
+}
+
+// WithClock sets the clock the windows of the schedule set with WithSchedule are evaluated against.
+// By default the system clock is used.
+func WithClock(clock Clock) OptionFunc {
+	return func(opts *option) error {
+		if clock == nil {
+			return errors.New("clock is nil")
+		}
+		opts.clock = clock
+		return nil
+	}
+}
+
 // withDifficultyFunc sets the difficulty function for the initializer.
 // NOTE: This is an internal option for tests and should not be used by external packages.
 func withDifficultyFunc(powDifficultyFunc func(uint64) []byte) OptionFunc {
@@ -176,6 +296,7 @@ type Initializer struct {
 	nonce            atomic.Pointer[uint64]
 	lastPosition     atomic.Pointer[uint64]
 	numLabelsWritten atomic.Uint64
+	computeBatchSize atomic.Uint64
 
 	diskState *DiskState
 	// TODO(mafa): we should lock with a lock file to prevent other processes from modifying the data concurrently
@@ -184,11 +305,25 @@ type Initializer struct {
 	logger            *Logger
 	referenceOracle   *oracle.WorkOracle
 	powDifficultyFunc func(uint64) []byte
+
+	// batchBuffers is a pool of *[]byte buffers the labels of a batch are computed into.
+	batchBuffers sync.Pool
+	// batchTuner adapts the compute batch size if automatic tuning is enabled, otherwise it is nil.
+	batchTuner *batchSizeTuner
+
+	nonceSearchProviders []uint32
+	nonceSearchBudget    nonceSearchBudget
+
+	hooks *hookDispatcher
+
+	schedule *Schedule
+	clock    Clock
 }
 
 func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 	options := &option{
 		logger: zap.NewNop(),
+		clock:  systemClock{},
 
 		powDifficultyFunc: shared.PowDifficulty,
 	}
@@ -213,6 +348,19 @@ func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 		logger:            options.logger,
 		powDifficultyFunc: options.powDifficultyFunc,
 		referenceOracle:   options.referenceOracle,
+		batchTuner:        options.batchTuner,
+
+		nonceSearchProviders: options.nonceSearchProviders,
+		nonceSearchBudget:    options.nonceSearchBudget,
+
+		hooks: newHookDispatcher(options.hooks),
+
+		schedule: options.schedule,
+		clock:    options.clock,
+	}
+	init.computeBatchSize.Store(init.opts.ComputeBatchSize)
+	if init.batchTuner != nil {
+		init.computeBatchSize.Store(init.batchTuner.size)
 	}
 
 	numLabelsWritten, err := init.diskState.NumLabelsWritten()
@@ -273,12 +421,29 @@ func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 
 // Initialize is the process in which the prover commits to store some data, by having its storage filled with
 // pseudo-random data with respect to a specific id. This data is the result of a computationally-expensive operation.
-func (init *Initializer) Initialize(ctx context.Context) error {
+func (init *Initializer) Initialize(ctx context.Context) (err error) {
 	if !init.mtx.TryLock() {
 		return ErrAlreadyInitializing
 	}
 	defer init.mtx.Unlock()
 
+	init.hooks.start()
+	defer init.hooks.stop()
+	defer func() {
+		if err != nil {
+			init.hooks.failed(err)
+			return
+		}
+		init.hooks.phaseChanged(PhaseDone)
+	}()
+
+	if init.schedule != nil {
+		return init.initializeScheduled(ctx)
+	}
+	return init.initialize(ctx)
+}
+
+func (init *Initializer) initialize(ctx context.Context) error {
 	layout, err := deriveFilesLayout(init.cfg, init.opts)
 	if err != nil {
 		return err
@@ -289,6 +454,8 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 		zap.Uint32("numUnits", init.opts.NumUnits),
 		zap.Uint64("maxFileSize", init.opts.MaxFileSize),
 		zap.Uint64("labelsPerUnit", init.cfg.LabelsPerUnit),
+		zap.Uint64("computeBatchSize", init.ComputeBatchSize()),
+		zap.Bool("adaptiveBatchSize", init.batchTuner != nil),
 	)
 
 	init.logger.Info("initialization file layout",
@@ -303,7 +470,6 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 
 	numLabels := uint64(init.opts.NumUnits) * init.cfg.LabelsPerUnit
 	difficulty := init.powDifficultyFunc(numLabels)
-	batchSize := init.opts.ComputeBatchSize
 
 	wo, err := oracle.New(
 		oracle.WithProviderID(init.opts.ProviderID),
@@ -333,6 +499,7 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 		defer woReference.Close()
 	}
 
+	init.hooks.phaseChanged(PhaseLabelling)
 	for i := layout.FirstFileIdx; i <= layout.LastFileIdx; i++ {
 		fileOffset := uint64(i) * layout.FileNumLabels
 		fileNumLabels := layout.FileNumLabels
@@ -340,7 +507,7 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 			fileNumLabels = layout.LastFileNumLabels
 		}
 
-		if err := init.initFile(ctx, wo, woReference, i, batchSize, fileOffset, fileNumLabels); err != nil {
+		if err := init.initFile(ctx, wo, woReference, i, fileOffset, fileNumLabels); err != nil {
 			return err
 		}
 	}
@@ -361,40 +528,57 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 	}
 
 	// continue searching for a nonce
-	defer init.saveMetadata()
+	workers, err := init.nonceSearchOracles(wo, difficulty)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, worker := range workers {
+			if worker != wo {
+				worker.Close()
+			}
+		}
+	}()
 
-	for i := *init.lastPosition.Load(); i < math.MaxUint64; i += batchSize {
-		lastPos := i
-		init.lastPosition.Store(&lastPos)
+	init.hooks.phaseChanged(PhaseNonceSearch)
+	return init.searchNonce(ctx, wo, workers)
+}
 
-		select {
-		case <-ctx.Done():
-			init.logger.Info("initialization: stopped")
-			return ctx.Err()
-		default:
-			// continue looking for a nonce
+// nonceSearchOracles returns the work oracles of the workers searching for a nonce. The oracle `wo` used to
+// compute the labels of the PoST data is reused for its provider. The other oracles need to be closed by the caller.
+func (init *Initializer) nonceSearchOracles(wo *oracle.WorkOracle, difficulty []byte) ([]*oracle.WorkOracle, error) {
+	if len(init.nonceSearchProviders) == 0 {
+		return []*oracle.WorkOracle{wo}, nil
+	}
+
+	workers := make([]*oracle.WorkOracle, 0, len(init.nonceSearchProviders))
+	reused := false
+	for _, id := range init.nonceSearchProviders {
+		id := id
+		if !reused && init.opts.ProviderID != nil && *init.opts.ProviderID == id {
+			reused = true
+			workers = append(workers, wo)
+			continue
 		}
 
-		init.logger.Debug("initialization: continue looking for a nonce",
-			zap.Uint64("startPosition", i),
-			zap.Uint64("batchSize", batchSize),
+		worker, err := oracle.New(
+			oracle.WithProviderID(&id),
+			oracle.WithCommitment(init.commitment),
+			oracle.WithVRFDifficulty(difficulty),
+			oracle.WithScryptParams(init.opts.Scrypt),
+			oracle.WithLogger(init.logger),
 		)
-
-		res, err := wo.Positions(i, i+batchSize-1)
 		if err != nil {
-			return err
-		}
-		if res.Nonce != nil {
-			init.logger.Debug("initialization: found nonce",
-				zap.Uint64("nonce", *res.Nonce),
-			)
-
-			init.nonce.Store(res.Nonce)
-			return nil
+			for _, worker := range workers {
+				if worker != wo {
+					worker.Close()
+				}
+			}
+			return nil, fmt.Errorf("failed to create work oracle for provider %d: %w", id, err)
 		}
+		workers = append(workers, worker)
 	}
-
-	return errors.New("no nonce found")
+	return workers, nil
 }
 
 func removeRedundantFiles(cfg config.Config, opts config.InitOpts, logger *zap.Logger) error {
@@ -426,6 +610,33 @@ func removeRedundantFiles(cfg config.Config, opts config.InitOpts, logger *zap.L
 	return nil
 }
 
+// ComputeBatchSize returns the number of labels computed in a single batch.
+// If automatic tuning is enabled with WithAdaptiveBatchSize the value changes during initialization.
+func (init *Initializer) ComputeBatchSize() uint64 {
+	return init.computeBatchSize.Load()
+}
+
+// observeBatch updates the compute batch size with the time it took to compute a batch of `numLabels` labels
+// if automatic tuning is enabled.
+func (init *Initializer) observeBatch(numLabels uint64, elapsed time.Duration) {
+	if init.batchTuner == nil {
+		return
+	}
+
+	previous := init.ComputeBatchSize()
+	next := init.batchTuner.observe(numLabels, elapsed)
+	init.computeBatchSize.Store(next)
+	if next != previous {
+		init.logger.Info("initialization: adjusted compute batch size",
+			zap.Uint64("previousBatchSize", previous),
+			zap.Uint64("computeBatchSize", next),
+			zap.Duration("batchDuration", elapsed),
+			zap.Float64("labelsPerSecond", float64(numLabels)/elapsed.Seconds()),
+		)
+		init.hooks.batchSizeChanged(next)
+	}
+}
+
 func (init *Initializer) NumLabelsWritten() uint64 {
 	return init.numLabelsWritten.Load()
 }
@@ -499,7 +710,7 @@ func (init *Initializer) initFile(
 	ctx context.Context,
 	wo, woReference *oracle.WorkOracle,
 	fileIndex int,
-	batchSize, fileOffset, fileNumLabels uint64,
+	fileOffset, fileNumLabels uint64,
 ) error {
 	fileTargetPosition := fileOffset + fileNumLabels
 
@@ -526,6 +737,7 @@ func (init *Initializer) initFile(
 	case numLabelsWritten == fileNumLabels:
 		init.logger.Info("initialization: file already initialized", fields...)
 		init.numLabelsWritten.Store(fileTargetPosition)
+		init.hooks.fileCompleted(fileIndex, fileNumLabels)
 		return nil
 
 	case numLabelsWritten > fileNumLabels:
@@ -534,6 +746,7 @@ func (init *Initializer) initFile(
 			return err
 		}
 		init.numLabelsWritten.Store(fileTargetPosition)
+		init.hooks.fileCompleted(fileIndex, fileNumLabels)
 		return nil
 
 	case numLabelsWritten > 0:
@@ -543,7 +756,10 @@ func (init *Initializer) initFile(
 		init.logger.Info("initialization: starting to write file", fields...)
 	}
 
-	for currentPosition := numLabelsWritten; currentPosition < fileNumLabels; currentPosition += batchSize {
+	buf := init.batchBuffer(init.ComputeBatchSize())
+	defer func() { init.batchBuffers.Put(buf) }()
+
+	for currentPosition := numLabelsWritten; currentPosition < fileNumLabels; {
 		select {
 		case <-ctx.Done():
 			init.logger.Info("initialization: stopped")
@@ -556,68 +772,57 @@ func (init *Initializer) initFile(
 		}
 
 		// The last batch might need to be smaller.
+		batchSize := init.ComputeBatchSize()
 		remaining := fileNumLabels - currentPosition
 		if remaining < batchSize {
 			batchSize = remaining
 		}
+		// The buffer might be shorter than its capacity if the batch size grew since it was taken from the pool.
+		if size := batchSize * postrs.LabelLength; uint64(cap(*buf)) < size {
+			init.batchBuffers.Put(buf)
+			buf = init.batchBuffer(batchSize)
+		} else {
+			*buf = (*buf)[:size]
+		}
 
 		init.logger.Debug("initialization: status",
 			zap.Int("fileIndex", fileIndex),
 			zap.Uint64("currentPosition", currentPosition),
 			zap.Uint64("remaining", remaining),
+			zap.Uint64("batchSize", batchSize),
 		)
 
 		// Calculate labels of the batch position range.
 		startPosition := fileOffset + currentPosition
 		endPosition := startPosition + uint64(batchSize) - 1
 
-		res, err := wo.Positions(startPosition, endPosition)
-		if err != nil {
+		start := time.Now()
+		res, err := wo.PositionsIntoContext(ctx, *buf, startPosition, endPosition)
+		elapsed := time.Since(start)
+		stopped := err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err())
+		if err != nil && !stopped {
 			return fmt.Errorf("failed to compute labels: %w", err)
 		}
 
-		// sanity check with reference oracle
-		reference, err := woReference.Position(endPosition)
-		if err != nil {
-			return fmt.Errorf("failed to compute reference label: %w", err)
-		}
-		if !bytes.Equal(res.Output[(batchSize-1)*postrs.LabelLength:], reference.Output) {
-			return ErrReferenceLabelMismatch{
-				Index:      endPosition,
-				Commitment: init.commitment,
-				Expected:   reference.Output,
-				Actual:     res.Output[(batchSize-1)*postrs.LabelLength:],
+		// If initialization was stopped while computing the batch, the labels that were already
+		// computed are still persisted.
+		if numComputed := uint64(len(res.Output)) / postrs.LabelLength; numComputed > 0 {
+			if err := init.writeBatch(writer, woReference, fileIndex, startPosition, res); err != nil {
+				return err
 			}
+			init.numLabelsWritten.Store(fileOffset + currentPosition + numComputed)
 		}
 
-		if res.Nonce != nil {
-			candidate := res.Output[(*res.Nonce-startPosition)*postrs.LabelLength:]
-			candidate = candidate[:postrs.LabelLength]
-
-			fields := []zap.Field{
-				zap.Int("fileIndex", fileIndex),
-				zap.Uint64("nonce", *res.Nonce),
-				zap.String("value", hex.EncodeToString(candidate)),
-			}
-			init.logger.Debug("initialization: found nonce", fields...)
-
-			if init.nonceValue.Load() == nil || bytes.Compare(candidate, *init.nonceValue.Load()) < 0 {
-				nonceValue := make([]byte, postrs.LabelLength)
-				copy(nonceValue, candidate)
-
-				init.logger.Info("initialization: found new best nonce", fields...)
-				init.nonce.Store(res.Nonce)
-				init.nonceValue.Store(&nonceValue)
-				init.saveMetadata()
+		if stopped {
+			init.logger.Info("initialization: stopped")
+			if err := writer.Flush(); err != nil {
+				return err
 			}
+			return ctx.Err()
 		}
 
-		// Write labels batch to disk.
-		if err := writer.Write(res.Output); err != nil {
-			return err
-		}
-
-		init.numLabelsWritten.Store(fileOffset + currentPosition + uint64(batchSize))
+		init.observeBatch(batchSize, elapsed)
+		currentPosition += batchSize
 	}
 
 	if err := writer.Flush(); err != nil {
@@ -633,9 +838,76 @@ func (init *Initializer) initFile(
 		zap.Int("fileIndex", fileIndex),
 		zap.Uint64("numLabelsWritten", numLabelsWritten),
 	)
+	init.hooks.fileCompleted(fileIndex, numLabelsWritten)
 	return nil
 }
 
+// writeBatch checks the labels computed for a batch starting at `startPosition` against the reference oracle,
+// updates the best nonce if the batch contains a better one and writes the labels to disk.
+func (init *Initializer) writeBatch(
+	writer *persistence.FileWriter,
+	woReference *oracle.WorkOracle,
+	fileIndex int,
+	startPosition uint64,
+	res oracle.WorkOracleResult,
+) error {
+	numLabels := uint64(len(res.Output)) / postrs.LabelLength
+	endPosition := startPosition + numLabels - 1
+
+	// sanity check with reference oracle
+	reference, err := woReference.Position(endPosition)
+	if err != nil {
+		return fmt.Errorf("failed to compute reference label: %w", err)
+	}
+	if !bytes.Equal(res.Output[(numLabels-1)*postrs.LabelLength:], reference.Output) {
+		return ErrReferenceLabelMismatch{
+			Index:      endPosition,
+			Commitment: init.commitment,
+			Expected:   reference.Output,
+			Actual:     res.Output[(numLabels-1)*postrs.LabelLength:],
+		}
+	}
+
+	if res.Nonce != nil {
+		candidate := res.Output[(*res.Nonce-startPosition)*postrs.LabelLength:]
+		candidate = candidate[:postrs.LabelLength]
+
+		fields := []zap.Field{
+			zap.Int("fileIndex", fileIndex),
+			zap.Uint64("nonce", *res.Nonce),
+			zap.String("value", hex.EncodeToString(candidate)),
+		}
+		init.logger.Debug("initialization: found nonce", fields...)
+
+		if init.nonceValue.Load() == nil || bytes.Compare(candidate, *init.nonceValue.Load()) < 0 {
+			nonceValue := make([]byte, postrs.LabelLength)
+			copy(nonceValue, candidate)
+
+			init.logger.Info("initialization: found new best nonce", fields...)
+			init.nonce.Store(res.Nonce)
+			init.nonceValue.Store(&nonceValue)
+			init.saveMetadata()
+			init.hooks.nonceFound(*res.Nonce, nonceValue)
+		}
+	}
+
+	// Write labels batch to disk.
+	return writer.Write(res.Output)
+}
+
+// batchBuffer returns a buffer from the pool that is large enough to hold `numLabels` labels.
+// The buffer should be returned to `init.batchBuffers` when it is no longer used.
+func (init *Initializer) batchBuffer(numLabels uint64) *[]byte {
+	size := numLabels * postrs.LabelLength
+	if buf, ok := init.batchBuffers.Get().(*[]byte); ok && uint64(cap(*buf)) >= size {
+		*buf = (*buf)[:size]
+		return buf
+	}
+
+	buf := make([]byte, size)
+	return &buf
+}
+
 func (init *Initializer) verifyMetadata(m *shared.PostMetadata) error {
 	if !bytes.Equal(init.nodeId, m.NodeId) {
 		return ConfigMismatchError{
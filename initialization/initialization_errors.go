@@ -3,12 +3,15 @@ package initialization
 import (
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/spacemeshos/post/persistence"
 )
 
 var (
 	ErrAlreadyInitializing          = errors.New("already initializing")
 	ErrCannotResetWhileInitializing = errors.New("cannot reset while initializing")
-	ErrStateMetadataFileMissing     = errors.New("metadata file is missing")
+	ErrStateMetadataFileMissing     = persistence.ErrMetadataFileMissing
 )
 
 type ErrReferenceLabelMismatch struct {
@@ -27,3 +30,22 @@ func (e ErrReferenceLabelMismatch) Error() string {
 		e.Actual,
 	)
 }
+
+// ErrNonceSearchBudgetExceeded is returned by Initialize if no nonce was found within the budget
+// set with WithNonceSearchBudget.
+type ErrNonceSearchBudgetExceeded struct {
+	// Searched is the number of positions searched in this run.
+	Searched uint64
+	// Elapsed is the time spent searching in this run.
+	Elapsed time.Duration
+	// LastPosition is the position the search continues from when initializing again.
+	LastPosition uint64
+}
+
+func (e ErrNonceSearchBudgetExceeded) Error() string {
+	return fmt.Sprintf("nonce search budget exceeded: searched %d positions in %v, continuing from position %d",
+		e.Searched,
+		e.Elapsed,
+		e.LastPosition,
+	)
+}
@@ -19,6 +19,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
 	"github.com/spacemeshos/post/oracle"
 	"github.com/spacemeshos/post/persistence"
 	"github.com/spacemeshos/post/shared"
@@ -76,6 +77,99 @@ func TestInitialize(t *testing.T) {
 	require.NoError(t, verifying.VerifyVRFNonce(init.Nonce(), m, verifying.WithLabelScryptParams(opts.Scrypt)))
 }
 
+func TestInitialize_AdaptiveBatchSize(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	cfg.LabelsPerUnit = 1 << 14
+
+	var batchSizes []uint64
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithAdaptiveBatchSize(time.Minute, 4*minAdaptiveBatchSize*postrs.LabelLength),
+		OnBatchSizeChange(func(batchSize uint64) { batchSizes = append(batchSizes, batchSize) }),
+	)
+	require.NoError(t, err)
+	require.EqualValues(t, minAdaptiveBatchSize, init.ComputeBatchSize())
+
+	require.NoError(t, init.Initialize(context.Background()))
+	require.Equal(t, uint64(cfg.MinNumUnits)*cfg.LabelsPerUnit, init.NumLabelsWritten())
+	// computing a batch takes far less than the latency target, so the batch size is only limited by memory.
+	require.EqualValues(t, 4*minAdaptiveBatchSize, init.ComputeBatchSize())
+	// every change of the batch size is reported, it only grows.
+	require.NotEmpty(t, batchSizes)
+	require.IsIncreasing(t, batchSizes)
+	require.Equal(t, init.ComputeBatchSize(), batchSizes[len(batchSizes)-1])
+
+	m := &shared.VRFNonceMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	require.NoError(t, verifying.VerifyVRFNonce(init.Nonce(), m, verifying.WithLabelScryptParams(opts.Scrypt)))
+}
+
+func TestInitialize_AdaptiveBatchSize_ShrinkThenGrow(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	labelsPerFile := uint64(8 * minAdaptiveBatchSize)
+	cfg.LabelsPerUnit = 3 * labelsPerFile
+	opts.MaxFileSize = labelsPerFile * postrs.LabelLength
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithAdaptiveBatchSize(time.Minute, 4*minAdaptiveBatchSize*postrs.LabelLength),
+	)
+	require.NoError(t, err)
+
+	// file 0 grows the batch size to the memory limit.
+	init.opts.ToFileIdx = new(int)
+	require.NoError(t, init.Initialize(context.Background()))
+	require.EqualValues(t, 4*minAdaptiveBatchSize, init.ComputeBatchSize())
+
+	// file 1 shrinks it again, leaving a large buffer of the previous file in the pool.
+	init.batchTuner.target = time.Nanosecond
+	*init.opts.ToFileIdx = 1
+	require.NoError(t, init.Initialize(context.Background()))
+	require.EqualValues(t, minAdaptiveBatchSize, init.ComputeBatchSize())
+
+	// file 2 starts with the small batch size and grows it while reusing the pooled buffer.
+	init.batchTuner.target = time.Minute
+	init.opts.ToFileIdx = nil
+	require.NoError(t, init.Initialize(context.Background()))
+	require.EqualValues(t, 4*minAdaptiveBatchSize, init.ComputeBatchSize())
+	require.Equal(t, 3*labelsPerFile, init.NumLabelsWritten())
+}
+
+func TestInitialize_AdaptiveBatchSize_InvalidOptions(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+
+	_, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithAdaptiveBatchSize(0, DefaultBatchMaxMemory),
+	)
+	require.ErrorContains(t, err, "invalid `latencyTarget`")
+
+	_, err = NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithAdaptiveBatchSize(DefaultBatchLatencyTarget, postrs.LabelLength),
+	)
+	require.ErrorContains(t, err, "invalid `maxMemory`")
+}
+
 func TestInitialize_BeforeNonceValue(t *testing.T) {
 	cfg, opts := getTestConfig(t)
 
@@ -0,0 +1,681 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/natefinch/atomic"
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+// ManagerStateFileName is the name of the file in the state directory of a Manager it persists its state to.
+const ManagerStateFileName = "postdata_manager.json"
+
+var (
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrIdentityAlreadyExists = errors.New("identity already exists")
+	ErrManagerAlreadyRunning = errors.New("manager already running")
+)
+
+// IdentityState is the state of an identity managed by a Manager.
+type IdentityState int
+
+const (
+	// IdentityQueued identities wait for a compute provider to become available.
+	IdentityQueued IdentityState = iota
+	// IdentityRunning identities are being initialized.
+	IdentityRunning
+	// IdentityPaused identities are not scheduled until they are resumed.
+	IdentityPaused
+	// IdentityCompleted identities finished initializing.
+	IdentityCompleted
+	// IdentityFailed identities stopped with an error. They are not scheduled until they are resumed.
+	IdentityFailed
+)
+
+func (s IdentityState) String() string {
+	switch s {
+	case IdentityQueued:
+		return "queued"
+	case IdentityRunning:
+		return "running"
+	case IdentityPaused:
+		return "paused"
+	case IdentityCompleted:
+		return "completed"
+	case IdentityFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+func (s IdentityState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *IdentityState) UnmarshalText(text []byte) error {
+	for state := IdentityQueued; state <= IdentityFailed; state++ {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid identity state: %s", text)
+}
+
+// Identity describes an identity whose PoST data is initialized by a Manager.
+type Identity struct {
+	NodeId          []byte
+	CommitmentAtxId []byte
+
+	// Opts are the options used to initialize the PoST data of the identity. `Opts.ProviderID` is ignored,
+	// the Manager sets it to the provider the identity is scheduled on.
+	Opts config.InitOpts
+
+	// Priority of the identity. Identities with a higher priority are scheduled first, identities with the same
+	// priority in the order they were added.
+	Priority int
+}
+
+// IdentityStatus is the status of an identity managed by a Manager.
+type IdentityStatus struct {
+	NodeId  []byte
+	DataDir string
+	State   IdentityState
+
+	// ProviderID is the provider the identity is initialized on while it is running, otherwise nil.
+	ProviderID *uint32
+
+	NumLabelsWritten uint64
+	NumLabels        uint64
+	Nonce            *uint64
+
+	// Err is the error that stopped the initialization of a failed identity.
+	Err error
+}
+
+// ManagerStatus is the combined status of all identities managed by a Manager.
+type ManagerStatus struct {
+	// Identities are the statuses of the identities in the order they are scheduled.
+	Identities []IdentityStatus
+
+	NumLabelsWritten uint64
+	NumLabels        uint64
+}
+
+// Count returns the number of identities in the given state.
+func (s ManagerStatus) Count(state IdentityState) int {
+	n := 0
+	for _, id := range s.Identities {
+		if id.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+type managerOption struct {
+	cfg       *Config
+	providers []uint32
+	stateDir  string
+	logger    *zap.Logger
+
+	initializerOpts []OptionFunc
+}
+
+func (o *managerOption) validate() error {
+	if o.cfg == nil {
+		return errors.New("no config provided")
+	}
+
+	if len(o.providers) == 0 {
+		return errors.New("no providers provided")
+	}
+
+	if o.stateDir == "" {
+		return errors.New("no state directory provided")
+	}
+
+	// Access to OpenCL providers is serialized, so identities scheduled on different OpenCL providers
+	// would block each other.
+	var openCLProvider *uint32
+	for _, id := range o.providers {
+		id := id
+		switch {
+		case id == CPUProviderID():
+		case openCLProvider == nil:
+			openCLProvider = &id
+		default:
+			return fmt.Errorf("invalid provider %d: only one OpenCL provider (%d) can be used", id, *openCLProvider)
+		}
+	}
+	return nil
+}
+
+type ManagerOptionFunc func(*managerOption) error
+
+// WithManagerConfig sets the config used to initialize all identities.
+func WithManagerConfig(cfg Config) ManagerOptionFunc {
+	return func(opts *managerOption) error {
+		opts.cfg = &cfg
+		return nil
+	}
+}
+
+// WithManagerProviders sets the compute providers the identities are scheduled on. Every provider initializes
+// one identity at a time. The CPU provider can be listed multiple times to initialize several identities on
+// the CPU in parallel, but at most one OpenCL provider can be used.
+func WithManagerProviders(ids ...uint32) ManagerOptionFunc {
+	return func(opts *managerOption) error {
+		opts.providers = ids
+		return nil
+	}
+}
+
+// WithManagerStateDir sets the directory the Manager persists its state to.
+func WithManagerStateDir(dir string) ManagerOptionFunc {
+	return func(opts *managerOption) error {
+		opts.stateDir = dir
+		return nil
+	}
+}
+
+// WithManagerLogger sets the logger for the Manager and the Initializers it creates.
+func WithManagerLogger(logger *zap.Logger) ManagerOptionFunc {
+	return func(opts *managerOption) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		opts.logger = logger
+		return nil
+	}
+}
+
+// WithManagerInitializerOptions sets additional options passed to the Initializer of every identity.
+func WithManagerInitializerOptions(opts ...OptionFunc) ManagerOptionFunc {
+	return func(o *managerOption) error {
+		o.initializerOpts = opts
+		return nil
+	}
+}
+
+type managedIdentity struct {
+	Identity
+	seq uint64
+
+	state            IdentityState
+	err              error
+	numLabelsWritten uint64
+	nonce            *uint64
+
+	// these fields are only set while the identity is running
+	provider *uint32
+	init     *Initializer
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	pauseRequested  bool
+	removeRequested bool
+}
+
+func (id *managedIdentity) key() string {
+	return hex.EncodeToString(id.NodeId)
+}
+
+// Manager initializes the PoST data of several identities, scheduling them on the available compute providers
+// by priority. Its state is persisted, so a new Manager with the same state directory continues where the
+// previous one stopped.
+type Manager struct {
+	cfg             Config
+	stateDir        string
+	logger          *zap.Logger
+	initializerOpts []OptionFunc
+
+	mtx        sync.Mutex
+	identities map[string]*managedIdentity
+	nextSeq    uint64
+	providers  []uint32 // providers that are not used by a running identity
+	running    bool
+	wake       chan struct{}
+}
+
+// NewManager creates a new Manager and restores the identities persisted in its state directory.
+func NewManager(opts ...ManagerOptionFunc) (*Manager, error) {
+	options := &managerOption{
+		logger: zap.NewNop(),
+	}
+
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		cfg:             *options.cfg,
+		stateDir:        options.stateDir,
+		logger:          options.logger,
+		initializerOpts: options.initializerOpts,
+		identities:      make(map[string]*managedIdentity),
+		providers:       append([]uint32(nil), options.providers...),
+		wake:            make(chan struct{}, 1),
+	}
+
+	if err := m.loadState(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add adds an identity to the Manager and queues it for initialization.
+func (m *Manager) Add(id Identity) error {
+	if len(id.NodeId) != 32 {
+		return fmt.Errorf("invalid `NodeId` length; expected: 32, given: %v", len(id.NodeId))
+	}
+	if len(id.CommitmentAtxId) != 32 {
+		return fmt.Errorf("invalid `CommitmentAtxId` length; expected: 32, given: %v", len(id.CommitmentAtxId))
+	}
+	if id.Opts.DataDir == "" {
+		return errors.New("`Opts.DataDir` is required")
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, other := range m.identities {
+		switch {
+		case bytes.Equal(other.NodeId, id.NodeId):
+			return fmt.Errorf("%w: node id %x", ErrIdentityAlreadyExists, id.NodeId)
+		case filepath.Clean(other.Opts.DataDir) == filepath.Clean(id.Opts.DataDir):
+			return fmt.Errorf("%w: data dir %s", ErrIdentityAlreadyExists, id.Opts.DataDir)
+		}
+	}
+
+	managed := &managedIdentity{
+		Identity: id,
+		seq:      m.nextSeq,
+		state:    IdentityQueued,
+	}
+	managed.numLabelsWritten, _ = NewDiskState(id.Opts.DataDir, uint(config.BitsPerLabel)).NumLabelsWritten()
+	m.nextSeq++
+	m.identities[managed.key()] = managed
+
+	m.logger.Info("initialization manager: added identity",
+		zap.String("nodeId", managed.key()),
+		zap.String("datadir", id.Opts.DataDir),
+		zap.Int("priority", id.Priority),
+	)
+	m.notify()
+	return m.saveState()
+}
+
+// Remove stops the initialization of an identity and removes it from the Manager. The PoST data of
+// the identity is kept on disk. Remove returns after the identity stopped writing to its data directory.
+func (m *Manager) Remove(nodeId []byte) error {
+	m.mtx.Lock()
+	id, ok := m.identities[hex.EncodeToString(nodeId)]
+	if !ok {
+		m.mtx.Unlock()
+		return ErrIdentityNotFound
+	}
+
+	if id.state != IdentityRunning {
+		delete(m.identities, id.key())
+		defer m.mtx.Unlock()
+		return m.saveState()
+	}
+
+	id.removeRequested = true
+	id.cancel()
+	done := id.done
+	m.mtx.Unlock()
+
+	<-done
+	return nil
+}
+
+// Pause stops the initialization of an identity until it is resumed. A running identity releases its provider.
+func (m *Manager) Pause(nodeId []byte) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	id, ok := m.identities[hex.EncodeToString(nodeId)]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+
+	switch id.state {
+	case IdentityQueued:
+		id.state = IdentityPaused
+		return m.saveState()
+	case IdentityRunning:
+		id.pauseRequested = true
+		id.cancel()
+	}
+	return nil
+}
+
+// Resume queues a paused or failed identity for initialization again.
+func (m *Manager) Resume(nodeId []byte) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	id, ok := m.identities[hex.EncodeToString(nodeId)]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+
+	switch id.state {
+	case IdentityRunning:
+		id.pauseRequested = false
+	case IdentityPaused, IdentityFailed:
+		id.state = IdentityQueued
+		id.err = nil
+		m.notify()
+		return m.saveState()
+	}
+	return nil
+}
+
+// SetPriority changes the priority of an identity. It only affects the order in which identities
+// that are not running yet are scheduled.
+func (m *Manager) SetPriority(nodeId []byte, priority int) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	id, ok := m.identities[hex.EncodeToString(nodeId)]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+
+	id.Priority = priority
+	return m.saveState()
+}
+
+// Status returns the combined status of all identities.
+func (m *Manager) Status() ManagerStatus {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var status ManagerStatus
+	for _, id := range m.ordered() {
+		s := IdentityStatus{
+			NodeId:           id.NodeId,
+			DataDir:          id.Opts.DataDir,
+			State:            id.state,
+			NumLabelsWritten: id.numLabelsWritten,
+			NumLabels:        id.Opts.TotalLabels(m.cfg.LabelsPerUnit),
+			Nonce:            id.nonce,
+			Err:              id.err,
+		}
+		if id.state == IdentityRunning {
+			s.ProviderID = id.provider
+			if id.init != nil {
+				s.NumLabelsWritten = id.init.NumLabelsWritten()
+				s.Nonce = id.init.Nonce()
+			}
+		}
+
+		status.Identities = append(status.Identities, s)
+		status.NumLabelsWritten += s.NumLabelsWritten
+		status.NumLabels += s.NumLabels
+	}
+	return status
+}
+
+// Run schedules the identities on the providers until the context is canceled. It then stops all running
+// identities, which are continued by the next call to Run.
+func (m *Manager) Run(ctx context.Context) error {
+	m.mtx.Lock()
+	if m.running {
+		m.mtx.Unlock()
+		return ErrManagerAlreadyRunning
+	}
+	m.running = true
+	m.mtx.Unlock()
+
+	defer func() {
+		m.mtx.Lock()
+		m.running = false
+		m.mtx.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		m.schedule(ctx, &wg)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.wake:
+		}
+	}
+}
+
+// schedule starts the queued identities with the highest priority on the providers that are available.
+func (m *Manager) schedule(ctx context.Context, wg *sync.WaitGroup) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, id := range m.ordered() {
+		if len(m.providers) == 0 {
+			return
+		}
+		if id.state != IdentityQueued {
+			continue
+		}
+
+		provider := m.providers[0]
+		m.providers = m.providers[1:]
+
+		runCtx, cancel := context.WithCancel(ctx)
+		id.state = IdentityRunning
+		id.provider = &provider
+		id.cancel = cancel
+		id.done = make(chan struct{})
+
+		m.logger.Info("initialization manager: starting identity",
+			zap.String("nodeId", id.key()),
+			zap.String("datadir", id.Opts.DataDir),
+			zap.Uint32("provider", provider),
+		)
+
+		wg.Add(1)
+		go func(id *managedIdentity) {
+			defer wg.Done()
+			err := m.initialize(runCtx, id, provider)
+			m.finished(id, err)
+		}(id)
+	}
+}
+
+func (m *Manager) initialize(ctx context.Context, id *managedIdentity, provider uint32) error {
+	opts := id.Opts
+	opts.ProviderID = &provider
+
+	initOpts := make([]OptionFunc, 0, len(m.initializerOpts)+5)
+	initOpts = append(initOpts, m.initializerOpts...)
+	initOpts = append(initOpts,
+		WithNodeId(id.NodeId),
+		WithCommitmentAtxId(id.CommitmentAtxId),
+		WithConfig(m.cfg),
+		WithInitOpts(opts),
+		WithLogger(m.logger.With(zap.String("nodeId", id.key()))),
+	)
+
+	init, err := NewInitializer(initOpts...)
+	if err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	id.init = init
+	m.mtx.Unlock()
+
+	return init.Initialize(ctx)
+}
+
+// finished updates the state of an identity after its initialization stopped and frees its provider.
+func (m *Manager) finished(id *managedIdentity, err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	defer close(id.done)
+	id.cancel()
+	m.providers = append(m.providers, *id.provider)
+	if id.init != nil {
+		id.numLabelsWritten = id.init.NumLabelsWritten()
+		id.nonce = id.init.Nonce()
+	}
+
+	fields := []zap.Field{
+		zap.String("nodeId", id.key()),
+		zap.String("datadir", id.Opts.DataDir),
+	}
+	switch {
+	case id.removeRequested:
+		m.logger.Info("initialization manager: removed identity", fields...)
+		delete(m.identities, id.key())
+	case err == nil:
+		m.logger.Info("initialization manager: identity completed", fields...)
+		id.state = IdentityCompleted
+	case id.pauseRequested && errors.Is(err, context.Canceled):
+		m.logger.Info("initialization manager: paused identity", fields...)
+		id.state = IdentityPaused
+	case errors.Is(err, context.Canceled):
+		// the manager was stopped, continue when it runs again
+		id.state = IdentityQueued
+	default:
+		m.logger.Error("initialization manager: identity failed", append(fields, zap.Error(err))...)
+		id.state = IdentityFailed
+		id.err = err
+	}
+
+	id.provider = nil
+	id.init = nil
+	id.cancel = nil
+	id.pauseRequested = false
+	if err := m.saveState(); err != nil {
+		m.logger.Error("initialization manager: failed to save state", zap.Error(err))
+	}
+	m.notify()
+}
+
+// ordered returns the identities in the order they are scheduled.
+func (m *Manager) ordered() []*managedIdentity {
+	ids := make([]*managedIdentity, 0, len(m.identities))
+	for _, id := range m.identities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Priority != ids[j].Priority {
+			return ids[i].Priority > ids[j].Priority
+		}
+		return ids[i].seq < ids[j].seq
+	})
+	return ids
+}
+
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+		// the manager was already notified
+	}
+}
+
+type managerState struct {
+	Identities []persistedIdentity
+}
+
+type persistedIdentity struct {
+	Identity
+	State IdentityState
+	Err   string `json:",omitempty"`
+}
+
+func (m *Manager) saveState() error {
+	var state managerState
+	for _, id := range m.ordered() {
+		p := persistedIdentity{
+			Identity: id.Identity,
+			State:    id.state,
+		}
+		if p.State == IdentityRunning {
+			p.State = IdentityQueued
+		}
+		if id.err != nil {
+			p.Err = id.err.Error()
+		}
+		state.Identities = append(state.Identities, p)
+	}
+
+	err := os.MkdirAll(m.stateDir, shared.OwnerReadWriteExec)
+	switch {
+	case errors.Is(err, fs.ErrExist):
+	case err != nil:
+		return fmt.Errorf("dir creation failure: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode manager state: %w", err)
+	}
+
+	if err := atomic.WriteFile(filepath.Join(m.stateDir, ManagerStateFileName), bytes.NewBuffer(data)); err != nil {
+		return fmt.Errorf("write to disk failure: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) loadState() error {
+	data, err := os.ReadFile(filepath.Join(m.stateDir, ManagerStateFileName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("read file failure: %w", err)
+	}
+
+	var state managerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to decode manager state: %w", err)
+	}
+
+	for _, p := range state.Identities {
+		id := &managedIdentity{
+			Identity: p.Identity,
+			seq:      m.nextSeq,
+			state:    p.State,
+		}
+		if p.Err != "" {
+			id.err = errors.New(p.Err)
+		}
+		id.numLabelsWritten, _ = NewDiskState(id.Opts.DataDir, uint(config.BitsPerLabel)).NumLabelsWritten()
+		if meta, err := LoadMetadata(id.Opts.DataDir); err == nil {
+			id.nonce = meta.Nonce
+		}
+		m.nextSeq++
+		m.identities[id.key()] = id
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package initialization
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+func testIdentity(tb testing.TB, b byte, priority int) Identity {
+	_, opts := getTestConfig(tb)
+
+	nodeId := make([]byte, 32)
+	nodeId[0] = b
+	return Identity{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		Opts:            opts,
+		Priority:        priority,
+	}
+}
+
+func newTestManager(tb testing.TB, stateDir string, providers ...uint32) *Manager {
+	cfg, _ := getTestConfig(tb)
+	m, err := NewManager(
+		WithManagerConfig(cfg),
+		WithManagerProviders(providers...),
+		WithManagerStateDir(stateDir),
+		WithManagerLogger(zaptest.NewLogger(tb, zaptest.Level(zap.DebugLevel))),
+	)
+	require.NoError(tb, err)
+	return m
+}
+
+func runManager(tb testing.TB, m *Manager) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.Run(ctx) }()
+
+	return func() {
+		cancel()
+		require.ErrorIs(tb, <-errCh, context.Canceled)
+	}
+}
+
+func identityStatus(m *Manager, nodeId []byte) IdentityStatus {
+	for _, s := range m.Status().Identities {
+		if string(s.NodeId) == string(nodeId) {
+			return s
+		}
+	}
+	return IdentityStatus{}
+}
+
+func TestManager_InitializesAllIdentities(t *testing.T) {
+	cfg, _ := getTestConfig(t)
+	m := newTestManager(t, t.TempDir(), CPUProviderID(), CPUProviderID())
+
+	ids := []Identity{
+		testIdentity(t, 1, 0),
+		testIdentity(t, 2, 0),
+		testIdentity(t, 3, 0),
+	}
+	for _, id := range ids {
+		require.NoError(t, m.Add(id))
+	}
+	require.Equal(t, 3, m.Status().Count(IdentityQueued))
+
+	stop := runManager(t, m)
+	require.Eventually(t, func() bool {
+		return m.Status().Count(IdentityCompleted) == len(ids)
+	}, 10*time.Second, 10*time.Millisecond)
+	stop()
+
+	status := m.Status()
+	require.Equal(t, status.NumLabels, status.NumLabelsWritten)
+	for _, id := range ids {
+		s := identityStatus(m, id.NodeId)
+		require.Nil(t, s.ProviderID)
+		require.NotNil(t, s.Nonce)
+
+		meta := &shared.VRFNonceMetadata{
+			NodeId:          id.NodeId,
+			CommitmentAtxId: id.CommitmentAtxId,
+			NumUnits:        id.Opts.NumUnits,
+			LabelsPerUnit:   cfg.LabelsPerUnit,
+		}
+		require.NoError(t, verifying.VerifyVRFNonce(s.Nonce, meta, verifying.WithLabelScryptParams(id.Opts.Scrypt)))
+	}
+}
+
+func TestManager_Priority(t *testing.T) {
+	m := newTestManager(t, t.TempDir(), CPUProviderID())
+
+	low := testIdentity(t, 1, 0)
+	high := testIdentity(t, 2, 10)
+	require.NoError(t, m.Add(low))
+	require.NoError(t, m.Add(high))
+
+	status := m.Status()
+	require.Equal(t, high.NodeId, status.Identities[0].NodeId)
+	require.Equal(t, low.NodeId, status.Identities[1].NodeId)
+
+	stop := runManager(t, m)
+	defer stop()
+
+	// with a single provider the identity with the lower priority only starts after the other one completed
+	var startedEarly atomic.Bool
+	require.Eventually(t, func() bool {
+		status := m.Status()
+		if status.Identities[1].State != IdentityQueued && status.Identities[0].State != IdentityCompleted {
+			startedEarly.Store(true)
+		}
+		return status.Count(IdentityCompleted) == 2
+	}, 10*time.Second, time.Millisecond)
+	require.False(t, startedEarly.Load())
+}
+
+func TestManager_PauseResume(t *testing.T) {
+	m := newTestManager(t, t.TempDir(), CPUProviderID())
+
+	paused := testIdentity(t, 1, 10)
+	other := testIdentity(t, 2, 0)
+	require.NoError(t, m.Add(paused))
+	require.NoError(t, m.Add(other))
+	require.NoError(t, m.Pause(paused.NodeId))
+
+	stop := runManager(t, m)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		return identityStatus(m, other.NodeId).State == IdentityCompleted
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, IdentityPaused, identityStatus(m, paused.NodeId).State)
+	require.Zero(t, identityStatus(m, paused.NodeId).NumLabelsWritten)
+
+	require.NoError(t, m.Resume(paused.NodeId))
+	require.Eventually(t, func() bool {
+		return identityStatus(m, paused.NodeId).State == IdentityCompleted
+	}, 10*time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, m.Pause(make([]byte, 32)), ErrIdentityNotFound)
+	require.ErrorIs(t, m.Resume(make([]byte, 32)), ErrIdentityNotFound)
+}
+
+func TestManager_Remove(t *testing.T) {
+	stateDir := t.TempDir()
+	m := newTestManager(t, stateDir, CPUProviderID())
+
+	id := testIdentity(t, 1, 0)
+	require.NoError(t, m.Add(id))
+	require.ErrorIs(t, m.Add(id), ErrIdentityAlreadyExists)
+
+	require.NoError(t, m.Remove(id.NodeId))
+	require.Empty(t, m.Status().Identities)
+	require.ErrorIs(t, m.Remove(id.NodeId), ErrIdentityNotFound)
+
+	m = newTestManager(t, stateDir, CPUProviderID())
+	require.Empty(t, m.Status().Identities)
+}
+
+func TestManager_PersistsState(t *testing.T) {
+	stateDir := t.TempDir()
+	m := newTestManager(t, stateDir, CPUProviderID())
+
+	completed := testIdentity(t, 1, 5)
+	paused := testIdentity(t, 2, 0)
+	queued := testIdentity(t, 3, 1)
+	require.NoError(t, m.Add(completed))
+	require.NoError(t, m.Add(paused))
+	require.NoError(t, m.Add(queued))
+	require.NoError(t, m.Pause(paused.NodeId))
+	require.NoError(t, m.Pause(queued.NodeId))
+
+	stop := runManager(t, m)
+	require.Eventually(t, func() bool {
+		return identityStatus(m, completed.NodeId).State == IdentityCompleted
+	}, 10*time.Second, 10*time.Millisecond)
+	stop()
+	require.NoError(t, m.Resume(queued.NodeId))
+
+	// a new manager picks up where the previous one stopped
+	m = newTestManager(t, stateDir, CPUProviderID())
+	status := m.Status()
+	require.Len(t, status.Identities, 3)
+	require.Equal(t, completed.NodeId, status.Identities[0].NodeId)
+	require.Equal(t, IdentityCompleted, status.Identities[0].State)
+	require.NotNil(t, status.Identities[0].Nonce)
+	require.Equal(t, status.Identities[0].NumLabels, status.Identities[0].NumLabelsWritten)
+	require.Equal(t, queued.NodeId, status.Identities[1].NodeId)
+	require.Equal(t, IdentityQueued, status.Identities[1].State)
+	require.Equal(t, paused.NodeId, status.Identities[2].NodeId)
+	require.Equal(t, IdentityPaused, status.Identities[2].State)
+	require.Equal(t, paused.Opts, storedIdentity(t, m, paused.NodeId).Opts)
+
+	stop = runManager(t, m)
+	defer stop()
+	require.Eventually(t, func() bool {
+		return identityStatus(m, queued.NodeId).State == IdentityCompleted
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func storedIdentity(tb testing.TB, m *Manager, nodeId []byte) Identity {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, id := range m.identities {
+		if string(id.NodeId) == string(nodeId) {
+			return id.Identity
+		}
+	}
+	tb.Fatalf("identity %x not found", nodeId)
+	return Identity{}
+}
+
+func TestManager_FailedIdentity(t *testing.T) {
+	m := newTestManager(t, t.TempDir(), CPUProviderID())
+
+	id := testIdentity(t, 1, 0)
+	id.Opts.NumUnits = 0 // invalid
+	require.NoError(t, m.Add(id))
+
+	stop := runManager(t, m)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		return identityStatus(m, id.NodeId).State == IdentityFailed
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Error(t, identityStatus(m, id.NodeId).Err)
+}
+
+func TestManager_InvalidOptions(t *testing.T) {
+	cfg, _ := getTestConfig(t)
+
+	_, err := NewManager(WithManagerConfig(cfg), WithManagerStateDir(t.TempDir()))
+	require.ErrorContains(t, err, "no providers provided")
+
+	_, err = NewManager(
+		WithManagerConfig(cfg),
+		WithManagerProviders(1, CPUProviderID(), 2),
+		WithManagerStateDir(t.TempDir()),
+	)
+	require.ErrorContains(t, err, "only one OpenCL provider")
+
+	m := newTestManager(t, t.TempDir(), CPUProviderID())
+	id := testIdentity(t, 1, 0)
+	require.NoError(t, m.Add(id))
+
+	other := testIdentity(t, 2, 0)
+	other.Opts.DataDir = id.Opts.DataDir
+	require.ErrorIs(t, m.Add(other), ErrIdentityAlreadyExists)
+
+	other = testIdentity(t, 2, 0)
+	other.NodeId = other.NodeId[:16]
+	require.ErrorContains(t, m.Add(other), "invalid `NodeId` length")
+}
@@ -0,0 +1,266 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+)
+
+const (
+	// nonceSearchProgressInterval is the minimal interval between two progress logs of the nonce search.
+	nonceSearchProgressInterval = time.Minute
+	// nonceSearchCheckpointInterval is the minimal interval between two checkpoints of the searched position in
+	// the metadata. A search that is interrupted without returning loses at most this much work.
+	nonceSearchCheckpointInterval = time.Minute
+)
+
+var (
+	errNonceFound         = errors.New("nonce found")
+	errNonceSearchTimeout = errors.New("nonce search timed out")
+)
+
+// nonceSearchBudget limits the search for a nonce past the labels of the PoST data within a single call to
+// Initialize. A zero value means no limit.
+type nonceSearchBudget struct {
+	maxDuration  time.Duration
+	maxPositions uint64
+}
+
+// nonceSearch hands out the batches of positions to the workers searching for a nonce and keeps track of
+// the position up to which all labels have been searched.
+type nonceSearch struct {
+	init    *Initializer
+	started time.Time
+
+	mtx          sync.Mutex
+	from         uint64              // first position searched in this run
+	to           uint64              // first position not to be searched in this run
+	next         uint64              // first position of the next batch to hand out
+	inFlight     map[uint64]struct{} // first positions of batches that are currently searched
+	found        bool                // whether a nonce was found in this run
+	lastProgress time.Time
+
+	lastCheckpoint time.Time
+}
+
+// nextBatch returns the range of the next batch of at most `batchSize` positions to search or false if there are
+// no more positions to search.
+func (s *nonceSearch) nextBatch(batchSize uint64) (start, end uint64, ok bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.next >= s.to {
+		return 0, 0, false
+	}
+
+	start = s.next
+	end = s.to - 1
+	if s.to-start > batchSize {
+		end = start + batchSize - 1
+	}
+	s.next = end + 1
+	s.inFlight[start] = struct{}{}
+	return start, end, true
+}
+
+// batchDone marks the batch starting at `start` as searched and updates the position up to which all labels have
+// been searched. The position is checkpointed in the metadata at most every nonceSearchCheckpointInterval.
+func (s *nonceSearch) batchDone(start uint64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.inFlight, start)
+	lastPos := s.next
+	for pos := range s.inFlight {
+		lastPos = min(lastPos, pos)
+	}
+	if current := s.init.lastPosition.Load(); current != nil && *current >= lastPos {
+		return
+	}
+
+	s.init.lastPosition.Store(&lastPos)
+	if time.Since(s.lastCheckpoint) >= nonceSearchCheckpointInterval {
+		s.checkpoint()
+	}
+
+	if time.Since(s.lastProgress) >= nonceSearchProgressInterval {
+		s.lastProgress = time.Now()
+		searched := lastPos - s.from
+		s.init.logger.Info("initialization: nonce search progress",
+			zap.Uint64("lastPosition", lastPos),
+			zap.Uint64("searched", searched),
+			zap.Float64("positionsPerSecond", float64(searched)/time.Since(s.started).Seconds()),
+		)
+	}
+}
+
+// checkpoint saves the position up to which all labels have been searched in the metadata.
+func (s *nonceSearch) checkpoint() {
+	s.lastCheckpoint = time.Now()
+	if err := s.init.saveMetadata(); err != nil {
+		s.init.logger.Warn("initialization: failed to checkpoint nonce search", zap.Error(err))
+	}
+}
+
+// nonceFound stores the nonce found at `position` with the label `value` unless another worker
+// already found a better one.
+func (s *nonceSearch) nonceFound(position uint64, value []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.found && bytes.Compare(value, *s.init.nonceValue.Load()) >= 0 {
+		return
+	}
+	s.found = true
+
+	s.init.logger.Info("initialization: found nonce",
+		zap.Uint64("nonce", position),
+		zap.String("value", hex.EncodeToString(value)),
+	)
+	nonceValue := make([]byte, postrs.LabelLength)
+	copy(nonceValue, value)
+	s.init.nonce.Store(&position)
+	s.init.nonceValue.Store(&nonceValue)
+	if err := s.init.saveMetadata(); err != nil {
+		s.init.logger.Warn("initialization: failed to save nonce", zap.Error(err))
+	}
+	s.init.hooks.nonceFound(position, nonceValue)
+}
+
+// searchNonce continues searching for a nonce past the labels of the PoST data starting at `init.lastPosition`.
+// The positions are searched in batches that are distributed between the `workers`.
+//
+// If the batch size is tuned automatically (see WithAdaptiveBatchSize) the tuning continues during the search: the
+// worker that reuses `wo`, the oracle that computed the labels, feeds its batch timings to observeBatch. Workers on
+// other providers tune their own batch size starting from the current one, because their throughput differs.
+//
+// The search stops when a nonce is found, the context is canceled or the budget set with WithNonceSearchBudget
+// is exceeded. In every case `init.lastPosition` is the position up to which all labels have been searched and
+// it is saved in the metadata before searchNonce returns.
+func (init *Initializer) searchNonce(ctx context.Context, wo *oracle.WorkOracle, workers []*oracle.WorkOracle) error {
+	search := &nonceSearch{
+		init:         init,
+		started:      time.Now(),
+		from:         *init.lastPosition.Load(),
+		to:           math.MaxUint64,
+		inFlight:     make(map[uint64]struct{}),
+		lastProgress: time.Now(),
+	}
+	search.lastCheckpoint = search.started
+	search.next = search.from
+	if init.nonceSearchBudget.maxPositions > 0 && math.MaxUint64-search.from > init.nonceSearchBudget.maxPositions {
+		search.to = search.from + init.nonceSearchBudget.maxPositions
+	}
+
+	searchCtx := ctx
+	if init.nonceSearchBudget.maxDuration > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeoutCause(ctx, init.nonceSearchBudget.maxDuration, errNonceSearchTimeout)
+		defer cancel()
+	}
+
+	init.logger.Info("initialization: searching for a nonce",
+		zap.Uint64("startPosition", search.from),
+		zap.Uint64("batchSize", init.ComputeBatchSize()),
+		zap.Int("workers", len(workers)),
+		zap.Duration("maxDuration", init.nonceSearchBudget.maxDuration),
+		zap.Uint64("maxPositions", init.nonceSearchBudget.maxPositions),
+	)
+
+	// the tuner isn't safe for concurrent use, the workers on other providers tune copies taken before the search
+	var tuner *batchSizeTuner
+	if init.batchTuner != nil {
+		copied := *init.batchTuner
+		tuner = &copied
+	}
+
+	eg, egCtx := errgroup.WithContext(searchCtx)
+	for i, worker := range workers {
+		i, worker := i, worker
+		// observe records the time a batch took and returns the size of the next batch of the worker.
+		batchSize := init.ComputeBatchSize()
+		observe := func(uint64, time.Duration) uint64 { return batchSize }
+		switch {
+		case tuner == nil:
+		case worker == wo:
+			observe = func(numLabels uint64, elapsed time.Duration) uint64 {
+				init.observeBatch(numLabels, elapsed)
+				return init.ComputeBatchSize()
+			}
+		default:
+			own := *tuner
+			observe = own.observe
+		}
+
+		eg.Go(func() error {
+			buf := init.batchBuffer(batchSize)
+			defer func() { init.batchBuffers.Put(buf) }()
+
+			for {
+				start, end, ok := search.nextBatch(batchSize)
+				if !ok {
+					return nil
+				}
+				// The buffer might be shorter than its capacity if the batch size grew since it was taken.
+				if size := (end - start + 1) * postrs.LabelLength; uint64(cap(*buf)) < size {
+					init.batchBuffers.Put(buf)
+					buf = init.batchBuffer(end - start + 1)
+				} else {
+					*buf = (*buf)[:size]
+				}
+
+				init.logger.Debug("initialization: continue looking for a nonce",
+					zap.Int("worker", i),
+					zap.Uint64("startPosition", start),
+					zap.Uint64("endPosition", end),
+				)
+
+				batchStart := time.Now()
+				res, err := worker.PositionsIntoContext(egCtx, *buf, start, end)
+				if res.Nonce != nil {
+					offset := (*res.Nonce - start) * postrs.LabelLength
+					search.nonceFound(*res.Nonce, res.Output[offset:offset+postrs.LabelLength])
+					return errNonceFound
+				}
+				if err != nil {
+					return err
+				}
+				batchSize = observe(end-start+1, time.Since(batchStart))
+				search.batchDone(start)
+			}
+		})
+	}
+
+	err := eg.Wait()
+	search.checkpoint()
+	switch {
+	case errors.Is(err, errNonceFound):
+		return nil
+	case ctx.Err() != nil:
+		init.logger.Info("initialization: stopped")
+		return ctx.Err()
+	case errors.Is(context.Cause(searchCtx), errNonceSearchTimeout) && errors.Is(err, context.DeadlineExceeded),
+		err == nil && search.to != math.MaxUint64:
+		lastPos := *init.lastPosition.Load()
+		return ErrNonceSearchBudgetExceeded{
+			Searched:     lastPos - search.from,
+			Elapsed:      time.Since(search.started),
+			LastPosition: lastPos,
+		}
+	case err != nil:
+		return fmt.Errorf("failed to search for nonce: %w", err)
+	default:
+		return ErrNonceNotFound
+	}
+}
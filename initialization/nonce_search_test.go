@@ -0,0 +1,302 @@
+package initialization
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+// noNonceDifficulty returns a difficulty no label can satisfy.
+func noNonceDifficulty(uint64) []byte {
+	return make([]byte, 32)
+}
+
+func TestInitialize_NonceSearchWorkers(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithNonceSearchProviders(CPUProviderID(), CPUProviderID(), CPUProviderID()),
+		// use a higher difficulty to make sure no Pow is found in the first `numLabels` labels.
+		withDifficultyFunc(func(numLabels uint64) []byte {
+			x := new(big.Int).Lsh(big.NewInt(1), 256)
+			x.Div(x, big.NewInt(int64(numLabels)))
+			x.Div(x, big.NewInt(1024))
+
+			difficulty := make([]byte, 32)
+			return x.FillBytes(difficulty)
+		}),
+	)
+	r.NoError(err)
+
+	r.NoError(init.Initialize(context.Background()))
+	r.NotNil(init.Nonce())
+	r.GreaterOrEqual(*init.Nonce(), uint64(cfg.MinNumUnits)*cfg.LabelsPerUnit)
+
+	m := &shared.VRFNonceMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	r.NoError(verifying.VerifyVRFNonce(init.Nonce(), m, verifying.WithLabelScryptParams(opts.Scrypt)))
+
+	meta, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Equal(*init.Nonce(), *meta.Nonce)
+	r.Equal(init.NonceValue(), []byte(meta.NonceValue))
+}
+
+func TestInitialize_NonceSearchBudget_Positions(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+	numLabels := uint64(cfg.MinNumUnits) * cfg.LabelsPerUnit
+	maxPositions := 3*opts.ComputeBatchSize + 100
+
+	newInitializer := func() *Initializer {
+		init, err := NewInitializer(
+			WithNodeId(nodeId),
+			WithCommitmentAtxId(commitmentAtxId),
+			WithConfig(cfg),
+			WithInitOpts(opts),
+			WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+			WithNonceSearchProviders(CPUProviderID(), CPUProviderID()),
+			WithNonceSearchBudget(0, maxPositions),
+			withDifficultyFunc(noNonceDifficulty),
+		)
+		r.NoError(err)
+		return init
+	}
+
+	err := newInitializer().Initialize(context.Background())
+	var budgetErr ErrNonceSearchBudgetExceeded
+	r.ErrorAs(err, &budgetErr)
+	r.Equal(maxPositions, budgetErr.Searched)
+	r.Equal(numLabels+maxPositions, budgetErr.LastPosition)
+
+	meta, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Nil(meta.Nonce)
+	r.NotNil(meta.LastPosition)
+	r.Equal(numLabels+maxPositions, *meta.LastPosition)
+
+	// initializing again continues the search where it stopped
+	err = newInitializer().Initialize(context.Background())
+	r.ErrorAs(err, &budgetErr)
+	r.Equal(maxPositions, budgetErr.Searched)
+	r.Equal(numLabels+2*maxPositions, budgetErr.LastPosition)
+
+	meta, err = LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Equal(numLabels+2*maxPositions, *meta.LastPosition)
+}
+
+func TestInitialize_NonceSearch_AdaptiveBatchSize(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+	// the worker reusing the oracle needs a few batches to tune the batch size, the budget is large enough for
+	// them even if the other worker searches most of the positions.
+	maxPositions := uint64(64 * minAdaptiveBatchSize)
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithAdaptiveBatchSize(time.Minute, 4*minAdaptiveBatchSize*postrs.LabelLength),
+		// the second worker uses another oracle and tunes its own batch size
+		WithNonceSearchProviders(CPUProviderID(), CPUProviderID()),
+		WithNonceSearchBudget(0, maxPositions),
+		withDifficultyFunc(noNonceDifficulty),
+	)
+	r.NoError(err)
+
+	var budgetErr ErrNonceSearchBudgetExceeded
+	r.ErrorAs(init.Initialize(context.Background()), &budgetErr)
+	r.Equal(maxPositions, budgetErr.Searched)
+	r.EqualValues(4*minAdaptiveBatchSize, init.ComputeBatchSize())
+
+	// the labels are computed already, so only the batches of the nonce search shrink the batch size
+	init.batchTuner.target = time.Nanosecond
+	r.ErrorAs(init.Initialize(context.Background()), &budgetErr)
+	r.Equal(maxPositions, budgetErr.Searched)
+	r.EqualValues(minAdaptiveBatchSize, init.ComputeBatchSize())
+}
+
+func TestInitialize_NonceSearchBudget_Duration(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+	numLabels := uint64(cfg.MinNumUnits) * cfg.LabelsPerUnit
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithNonceSearchProviders(CPUProviderID(), CPUProviderID()),
+		WithNonceSearchBudget(100*time.Millisecond, 0),
+		withDifficultyFunc(noNonceDifficulty),
+	)
+	r.NoError(err)
+
+	err = init.Initialize(context.Background())
+	var budgetErr ErrNonceSearchBudgetExceeded
+	r.ErrorAs(err, &budgetErr)
+	r.GreaterOrEqual(budgetErr.Elapsed, 100*time.Millisecond)
+	r.Equal(numLabels+budgetErr.Searched, budgetErr.LastPosition)
+
+	meta, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Nil(meta.Nonce)
+	r.Equal(budgetErr.LastPosition, *meta.LastPosition)
+}
+
+func TestInitialize_NonceSearchCanceled(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+	numLabels := uint64(cfg.MinNumUnits) * cfg.LabelsPerUnit
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithNonceSearchProviders(CPUProviderID(), CPUProviderID()),
+		withDifficultyFunc(noNonceDifficulty),
+	)
+	r.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		r.Eventually(func() bool {
+			lastPos := init.lastPosition.Load()
+			return lastPos != nil && *lastPos > numLabels
+		}, 10*time.Second, 10*time.Millisecond)
+		cancel()
+	}()
+
+	r.ErrorIs(init.Initialize(ctx), context.Canceled)
+
+	// the position is saved when the search stops, not only at the last checkpoint
+	meta, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Nil(meta.Nonce)
+	r.Greater(*meta.LastPosition, numLabels)
+	r.Equal(*init.lastPosition.Load(), *meta.LastPosition)
+}
+
+func TestNonceSearch_CheckpointThrottled(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+
+	from := uint64(1000)
+	init.lastPosition.Store(&from)
+	search := &nonceSearch{
+		init:           init,
+		from:           from,
+		to:             math.MaxUint64,
+		next:           from,
+		inFlight:       make(map[uint64]struct{}),
+		lastProgress:   time.Now(),
+		lastCheckpoint: time.Now(),
+	}
+	searchBatch := func() {
+		start, _, ok := search.nextBatch(100)
+		r.True(ok)
+		search.batchDone(start)
+	}
+
+	// the position is updated after every batch, but only saved once the interval passed
+	searchBatch()
+	r.Equal(from+100, *init.lastPosition.Load())
+	meta, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Nil(meta.LastPosition)
+
+	search.lastCheckpoint = time.Now().Add(-nonceSearchCheckpointInterval)
+	searchBatch()
+	meta, err = LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.NotNil(meta.LastPosition)
+	r.Equal(from+200, *meta.LastPosition)
+
+	searchBatch()
+	meta, err = LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Equal(from+200, *meta.LastPosition)
+}
+
+func TestInitialize_NonceSearchInvalidOptions(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+
+	newInitializer := func(opts ...OptionFunc) error {
+		_, err := NewInitializer(
+			append([]OptionFunc{
+				WithNodeId(nodeId),
+				WithCommitmentAtxId(commitmentAtxId),
+				WithConfig(cfg),
+				WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+			}, opts...)...,
+		)
+		return err
+	}
+
+	t.Run("no providers", func(t *testing.T) {
+		require.ErrorContains(t, newInitializer(WithInitOpts(opts), WithNonceSearchProviders()),
+			"at least one nonce search provider is required",
+		)
+	})
+
+	t.Run("multiple OpenCL providers", func(t *testing.T) {
+		require.ErrorContains(t, newInitializer(WithInitOpts(opts), WithNonceSearchProviders(1, CPUProviderID(), 2)),
+			"only one OpenCL provider",
+		)
+	})
+
+	t.Run("OpenCL provider differs from labelling provider", func(t *testing.T) {
+		opts := opts
+		opts.ProviderID = new(uint32)
+		*opts.ProviderID = 1
+		require.ErrorContains(t, newInitializer(WithInitOpts(opts), WithNonceSearchProviders(2)),
+			"only one OpenCL provider",
+		)
+	})
+
+	t.Run("negative duration", func(t *testing.T) {
+		require.ErrorContains(t, newInitializer(WithInitOpts(opts), WithNonceSearchBudget(-time.Second, 0)),
+			"invalid `maxDuration`",
+		)
+	})
+}
@@ -0,0 +1,254 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/shared"
+)
+
+// scanPosBlockSize is the number of consecutive labels ScanPos verifies at once. Files are sampled in blocks of
+// this size, so the invalid ranges it finds are exact within the sampled blocks.
+const scanPosBlockSize = 1024
+
+// LabelRange is a range of labels given by their index in the PoST data.
+type LabelRange struct {
+	// Start is the index of the first label of the range.
+	Start uint64
+	// End is the index after the last label of the range.
+	End uint64
+}
+
+// Len returns the number of labels in the range.
+func (r LabelRange) Len() uint64 {
+	return r.End - r.Start
+}
+
+// FilePosReport is the result of ScanPos for a single file.
+type FilePosReport struct {
+	FileIndex int
+	// NumLabels is the number of labels the file should hold.
+	NumLabels uint64
+	// Sampled is the number of labels that were verified.
+	Sampled uint64
+	// Invalid is the number of sampled labels that are invalid or missing.
+	Invalid uint64
+	// InvalidRanges are the ranges of invalid labels in ascending order.
+	InvalidRanges []LabelRange
+	// Missing is true if the file doesn't exist.
+	Missing bool
+}
+
+// PosReport is the result of ScanPos.
+type PosReport struct {
+	// Fraction is the percentage of labels of each file that were sampled.
+	Fraction float64
+	Files    []FilePosReport
+}
+
+// Valid returns whether all sampled labels are valid.
+func (r *PosReport) Valid() bool {
+	for _, f := range r.Files {
+		if f.Invalid > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// InvalidRanges returns the ranges of invalid labels of all files.
+func (r *PosReport) InvalidRanges() []LabelRange {
+	var ranges []LabelRange
+	for _, f := range r.Files {
+		ranges = append(ranges, f.InvalidRanges...)
+	}
+	return ranges
+}
+
+type scanPosOpts struct {
+	logger   *zap.Logger
+	fraction float64
+	rand     *rand.Rand
+}
+
+// ScanPosOptionFunc is an option of ScanPos.
+type ScanPosOptionFunc func(*scanPosOpts)
+
+// ScanWithLogger sets the logger ScanPos reports the files with invalid labels to.
+func ScanWithLogger(logger *zap.Logger) ScanPosOptionFunc {
+	return func(opts *scanPosOpts) {
+		opts.logger = logger
+	}
+}
+
+// ScanWithFraction sets the percentage of labels to verify in each file. Defaults to 5%.
+func ScanWithFraction(fraction float64) ScanPosOptionFunc {
+	return func(opts *scanPosOpts) {
+		opts.fraction = fraction
+	}
+}
+
+// ScanPos verifies the PoST data in `initOpts.DataDir` like postrs.VerifyPos, but it doesn't stop at the first
+// invalid label. It verifies the sampled labels of every file in the range given by `initOpts.FromFileIdx` and
+// `initOpts.ToFileIdx` and reports all invalid labels it finds, grouped by file. Labels missing from the disk
+// are reported as invalid.
+//
+// The labels are recomputed on the CPU with `initOpts.Scrypt`.
+func ScanPos(ctx context.Context, initOpts InitOpts, opts ...ScanPosOptionFunc) (*PosReport, error) {
+	options := scanPosOpts{
+		logger:   zap.NewNop(),
+		fraction: 5.0,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.fraction <= 0 || options.fraction > 100 {
+		return nil, fmt.Errorf("invalid `fraction`; expected: 0 < fraction <= 100, given: %v", options.fraction)
+	}
+
+	metadata, err := LoadMetadata(initOpts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+	labelsPerFile := metadata.MaxFileSize / postrs.LabelLength
+	if labelsPerFile == 0 {
+		return nil, fmt.Errorf("invalid `MaxFileSize` in metadata; expected: >= %d, given: %d",
+			postrs.LabelLength, metadata.MaxFileSize,
+		)
+	}
+	totalLabels := metadata.LabelsPerUnit * uint64(metadata.NumUnits)
+	lastFileIdx := int((totalLabels - 1) / labelsPerFile)
+	if initOpts.ToFileIdx != nil {
+		lastFileIdx = min(lastFileIdx, *initOpts.ToFileIdx)
+	}
+	if initOpts.FromFileIdx < 0 || initOpts.FromFileIdx > lastFileIdx {
+		return nil, fmt.Errorf("invalid range: first file index (%v) must be between 0 and %v",
+			initOpts.FromFileIdx, lastFileIdx,
+		)
+	}
+
+	cpuProviderID := CPUProviderID()
+	wo, err := oracle.New(
+		oracle.WithProviderID(&cpuProviderID),
+		oracle.WithCommitment(oracle.CommitmentBytes(metadata.NodeId, metadata.CommitmentAtxId)),
+		oracle.WithVRFDifficulty(make([]byte, 32)),
+		oracle.WithScryptParams(initOpts.Scrypt),
+		oracle.WithLogger(options.logger),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer wo.Close()
+
+	report := &PosReport{Fraction: options.fraction}
+	for fileIdx := initOpts.FromFileIdx; fileIdx <= lastFileIdx; fileIdx++ {
+		first := uint64(fileIdx) * labelsPerFile
+		numLabels := min(labelsPerFile, totalLabels-first)
+		fileReport, err := scanFile(ctx, wo, initOpts.DataDir, fileIdx, first, numLabels, &options)
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", shared.InitFileName(fileIdx), err)
+		}
+		if fileReport.Invalid > 0 {
+			options.logger.Warn("found invalid labels",
+				zap.String("file", shared.InitFileName(fileIdx)),
+				zap.Uint64("sampled", fileReport.Sampled),
+				zap.Uint64("invalid", fileReport.Invalid),
+				zap.Int("ranges", len(fileReport.InvalidRanges)),
+			)
+		}
+		report.Files = append(report.Files, *fileReport)
+	}
+	return report, nil
+}
+
+// scanFile verifies the sampled blocks of the file `fileIdx` holding `numLabels` labels starting at `first`.
+func scanFile(
+	ctx context.Context,
+	wo *oracle.WorkOracle,
+	datadir string,
+	fileIdx int,
+	first, numLabels uint64,
+	options *scanPosOpts,
+) (*FilePosReport, error) {
+	report := &FilePosReport{FileIndex: fileIdx, NumLabels: numLabels}
+
+	f, err := os.Open(filepath.Join(datadir, shared.InitFileName(fileIdx)))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		report.Missing = true
+	case err != nil:
+		return nil, err
+	default:
+		defer f.Close()
+	}
+
+	numBlocks := (numLabels + scanPosBlockSize - 1) / scanPosBlockSize
+	numSampled := uint64(math.Ceil(float64(numBlocks) * options.fraction / 100))
+	blocks := make([]uint64, 0, numSampled)
+	if numSampled >= numBlocks {
+		for i := uint64(0); i < numBlocks; i++ {
+			blocks = append(blocks, i)
+		}
+	} else {
+		for _, i := range options.rand.Perm(int(numBlocks))[:numSampled] {
+			blocks = append(blocks, uint64(i))
+		}
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	}
+
+	expected := make([]byte, scanPosBlockSize*postrs.LabelLength)
+	stored := make([]byte, scanPosBlockSize*postrs.LabelLength)
+	for _, block := range blocks {
+		start := block * scanPosBlockSize
+		end := min(start+scanPosBlockSize, numLabels)
+		size := (end - start) * postrs.LabelLength
+
+		var n int
+		if f != nil {
+			n, err = f.ReadAt(stored[:size], int64(start*postrs.LabelLength))
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+		}
+		res, err := wo.PositionsIntoContext(ctx, expected, first+start, first+end-1)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := uint64(0); i < end-start; i++ {
+			offset := i * postrs.LabelLength
+			if offset+postrs.LabelLength <= uint64(n) &&
+				bytes.Equal(stored[offset:offset+postrs.LabelLength], res.Output[offset:offset+postrs.LabelLength]) {
+				continue
+			}
+			report.addInvalid(first + start + i)
+		}
+		report.Sampled += end - start
+	}
+	return report, nil
+}
+
+// addInvalid records the label at `index` as invalid. Labels must be added in ascending order.
+func (r *FilePosReport) addInvalid(index uint64) {
+	r.Invalid++
+	if last := len(r.InvalidRanges) - 1; last >= 0 && r.InvalidRanges[last].End == index {
+		r.InvalidRanges[last].End++
+		return
+	}
+	r.InvalidRanges = append(r.InvalidRanges, LabelRange{Start: index, End: index + 1})
+}
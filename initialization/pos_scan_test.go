@@ -0,0 +1,105 @@
+package initialization
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestScanPos(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	cfg.LabelsPerUnit = 4072
+	opts.NumUnits = 2
+	opts.MaxFileSize = 3000 * postrs.LabelLength // 3000, 3000 and 2144 labels per file
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+	require.EqualValues(t, 8144, opts.TotalLabels(cfg.LabelsPerUnit))
+
+	report, err := ScanPos(context.Background(), opts, ScanWithFraction(100), ScanWithLogger(logger))
+	require.NoError(t, err)
+	require.True(t, report.Valid())
+	require.Empty(t, report.InvalidRanges())
+	require.Len(t, report.Files, 3)
+	for i, f := range report.Files {
+		require.Equal(t, i, f.FileIndex)
+		require.Equal(t, f.NumLabels, f.Sampled)
+	}
+	require.EqualValues(t, 2144, report.Files[2].NumLabels)
+
+	// corrupt labels 10-19 and 1500 of file 0, truncate the last 100 labels of file 1 and remove file 2
+	f, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, 10*postrs.LabelLength), 10*postrs.LabelLength)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, postrs.LabelLength), 1500*postrs.LabelLength)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Truncate(filepath.Join(opts.DataDir, shared.InitFileName(1)), 2900*postrs.LabelLength))
+	require.NoError(t, os.Remove(filepath.Join(opts.DataDir, shared.InitFileName(2))))
+
+	report, err = ScanPos(context.Background(), opts, ScanWithFraction(100))
+	require.NoError(t, err)
+	require.False(t, report.Valid())
+	require.Equal(t, []LabelRange{{Start: 10, End: 20}, {Start: 1500, End: 1501}}, report.Files[0].InvalidRanges)
+	require.EqualValues(t, 11, report.Files[0].Invalid)
+	require.Equal(t, []LabelRange{{Start: 5900, End: 6000}}, report.Files[1].InvalidRanges)
+	require.EqualValues(t, 100, report.Files[1].Invalid)
+	require.True(t, report.Files[2].Missing)
+	require.Equal(t, []LabelRange{{Start: 6000, End: 8144}}, report.Files[2].InvalidRanges)
+	require.Len(t, report.InvalidRanges(), 4)
+
+	// only the given files are scanned
+	opts.FromFileIdx = 1
+	opts.ToFileIdx = new(int)
+	*opts.ToFileIdx = 1
+	report, err = ScanPos(context.Background(), opts, ScanWithFraction(100))
+	require.NoError(t, err)
+	require.Len(t, report.Files, 1)
+	require.Equal(t, 1, report.Files[0].FileIndex)
+}
+
+func TestScanPos_Fraction(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	cfg.LabelsPerUnit = 4096
+	opts.NumUnits = 4
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	withRand := func(opts *scanPosOpts) {
+		opts.rand = rand.New(rand.NewSource(1))
+	}
+	report, err := ScanPos(context.Background(), opts, ScanWithFraction(25), withRand)
+	require.NoError(t, err)
+	require.True(t, report.Valid())
+	require.Len(t, report.Files, 1)
+	// 16 blocks of 1024 labels, 4 of them are sampled
+	require.EqualValues(t, 4*scanPosBlockSize, report.Files[0].Sampled)
+
+	_, err = ScanPos(context.Background(), opts, ScanWithFraction(0))
+	require.ErrorContains(t, err, "invalid `fraction`")
+}
@@ -0,0 +1,397 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/natefinch/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+// ErrInvalidPos is wrapped by the result of a file that contains an invalid label.
+var ErrInvalidPos = postrs.ErrInvalidPos
+
+// FileVerifyResult is the result of verifying a single file with VerifyPos.
+type FileVerifyResult struct {
+	FileIndex int
+	// Err is nil if the file is valid. It wraps ErrInvalidPos if the file contains an invalid label.
+	Err      error
+	Duration time.Duration
+	// Resumed is true if the file was verified by a previous run and its result was loaded from the state file.
+	Resumed bool
+}
+
+// VerifyPosProgress is passed to the progress callback of VerifyPos after every file.
+type VerifyPosProgress struct {
+	// Verified is the number of files verified so far, including the files of a previous run.
+	Verified int
+	// Failed is the number of files verified so far that aren't valid.
+	Failed int
+	Total  int
+	// Result is the result of the file that was verified last.
+	Result FileVerifyResult
+}
+
+// VerifyPosReport is the result of VerifyPos.
+type VerifyPosReport struct {
+	// Files are the results of the verified files ordered by file index.
+	Files    []FileVerifyResult
+	Total    int
+	Duration time.Duration
+}
+
+// Valid returns whether all files were verified and are valid.
+func (r *VerifyPosReport) Valid() bool {
+	return len(r.Files) == r.Total && len(r.Failed()) == 0
+}
+
+// Failed returns the results of the files that aren't valid.
+func (r *VerifyPosReport) Failed() []FileVerifyResult {
+	var failed []FileVerifyResult
+	for _, f := range r.Files {
+		if f.Err != nil {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+type verifyPosOpts struct {
+	logger    *zap.Logger
+	fraction  float64
+	workers   int
+	progress  func(VerifyPosProgress)
+	stateFile string
+
+	verifyFile verifyFileFunc
+}
+
+// verifyFileFunc verifies the file `fileIdx`, it is verifyPosFile outside of tests.
+type verifyFileFunc func(
+	datadir string,
+	fileIdx int,
+	fraction float64,
+	scrypt config.ScryptParams,
+	logger *zap.Logger,
+) error
+
+// VerifyPosOptionFunc is an option of VerifyPos.
+type VerifyPosOptionFunc func(*verifyPosOpts)
+
+// VerifyPosWithLogger sets the logger VerifyPos and postrs.VerifyPos report their progress to.
+func VerifyPosWithLogger(logger *zap.Logger) VerifyPosOptionFunc {
+	return func(opts *verifyPosOpts) {
+		opts.logger = logger
+	}
+}
+
+// VerifyPosWithFraction sets the percentage of labels to verify in each file. Defaults to 5%.
+func VerifyPosWithFraction(fraction float64) VerifyPosOptionFunc {
+	return func(opts *verifyPosOpts) {
+		opts.fraction = fraction
+	}
+}
+
+// VerifyPosWithWorkers sets the number of files verified at the same time. Defaults to 1.
+func VerifyPosWithWorkers(workers int) VerifyPosOptionFunc {
+	return func(opts *verifyPosOpts) {
+		opts.workers = workers
+	}
+}
+
+// VerifyPosWithProgress sets a callback that is called after every verified file. Calls don't overlap.
+func VerifyPosWithProgress(progress func(VerifyPosProgress)) VerifyPosOptionFunc {
+	return func(opts *verifyPosOpts) {
+		opts.progress = progress
+	}
+}
+
+// VerifyPosWithStateFile sets a file to record the results of verified files in. If the file exists when
+// VerifyPos is called with the same fraction and scrypt params, the files verified by the previous run are skipped.
+// Files that couldn't be verified, e.g. because verification was interrupted, are verified again. So are files whose
+// size or modification time changed since they were verified, e.g. because they were repaired.
+func VerifyPosWithStateFile(path string) VerifyPosOptionFunc {
+	return func(opts *verifyPosOpts) {
+		opts.stateFile = path
+	}
+}
+
+func verifyPosWithFileVerifier(verifyFile verifyFileFunc) VerifyPosOptionFunc {
+	return func(opts *verifyPosOpts) {
+		opts.verifyFile = verifyFile
+	}
+}
+
+// verifyPosFile verifies a single file with postrs.VerifyPos.
+func verifyPosFile(
+	datadir string,
+	fileIdx int,
+	fraction float64,
+	scrypt config.ScryptParams,
+	logger *zap.Logger,
+) error {
+	return postrs.VerifyPos(
+		datadir,
+		postrs.NewScryptParams(scrypt.N, scrypt.R, scrypt.P),
+		postrs.FromFile(uint32(fileIdx)),
+		postrs.ToFile(uint32(fileIdx)),
+		postrs.WithFraction(fraction),
+		postrs.VerifyPosWithLogger(logger),
+	)
+}
+
+// VerifyPos verifies the PoST data in `initOpts.DataDir` with postrs.VerifyPos. Every file in the range given by
+// `initOpts.FromFileIdx` and `initOpts.ToFileIdx` is verified on its own and the results of all files are
+// aggregated, so a single invalid file doesn't stop the verification of the others.
+//
+// If `ctx` is canceled, VerifyPos returns the results of the files verified so far together with ctx.Err().
+func VerifyPos(ctx context.Context, initOpts InitOpts, opts ...VerifyPosOptionFunc) (*VerifyPosReport, error) {
+	options := verifyPosOpts{
+		logger:     zap.NewNop(),
+		fraction:   5.0,
+		workers:    1,
+		progress:   func(VerifyPosProgress) {},
+		verifyFile: verifyPosFile,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.fraction <= 0 || options.fraction > 100 {
+		return nil, fmt.Errorf("invalid `fraction`; expected: 0 < fraction <= 100, given: %v", options.fraction)
+	}
+	if options.workers < 1 {
+		return nil, fmt.Errorf("invalid `workers`; expected: >= 1, given: %d", options.workers)
+	}
+	logger := options.logger
+
+	metadata, err := LoadMetadata(initOpts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+	labelsPerFile := metadata.MaxFileSize / postrs.LabelLength
+	if labelsPerFile == 0 {
+		return nil, fmt.Errorf("invalid `MaxFileSize` in metadata; expected: >= %d, given: %d",
+			postrs.LabelLength, metadata.MaxFileSize,
+		)
+	}
+	totalLabels := metadata.LabelsPerUnit * uint64(metadata.NumUnits)
+	lastFileIdx := int((totalLabels - 1) / labelsPerFile)
+	if initOpts.ToFileIdx != nil {
+		lastFileIdx = min(lastFileIdx, *initOpts.ToFileIdx)
+	}
+	if initOpts.FromFileIdx < 0 || initOpts.FromFileIdx > lastFileIdx {
+		return nil, fmt.Errorf("invalid range: first file index (%v) must be between 0 and %v",
+			initOpts.FromFileIdx, lastFileIdx,
+		)
+	}
+
+	state := &verifyPosState{
+		NodeId:          metadata.NodeId,
+		CommitmentAtxId: metadata.CommitmentAtxId,
+		Fraction:        options.fraction,
+		Scrypt:          initOpts.Scrypt,
+	}
+	if options.stateFile != "" {
+		state, err = loadVerifyPosState(options.stateFile, state, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	started := time.Now()
+	report := &VerifyPosReport{Total: lastFileIdx - initOpts.FromFileIdx + 1}
+	progress := VerifyPosProgress{Total: report.Total}
+	var mtx sync.Mutex
+	// info is the state of the file when its verification started, nil if the result is resumed
+	done := func(result FileVerifyResult, info fs.FileInfo) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		report.Files = append(report.Files, result)
+		progress.Verified++
+		if result.Err != nil {
+			progress.Failed++
+		}
+		progress.Result = result
+		if !result.Resumed && options.stateFile != "" {
+			state.add(result, info)
+			if err := state.save(options.stateFile); err != nil {
+				logger.Warn("failed to save verification state", zap.Error(err))
+			}
+		}
+		options.progress(progress)
+	}
+
+	// report the files verified by a previous run first, state is modified by the workers afterwards
+	var pending []int
+	for fileIdx := initOpts.FromFileIdx; fileIdx <= lastFileIdx; fileIdx++ {
+		f := state.file(fileIdx)
+		switch {
+		case f == nil:
+			pending = append(pending, fileIdx)
+		case f.changed(statInitFile(initOpts.DataDir, fileIdx)):
+			logger.Info("file changed since it was verified, verifying it again", zap.Int("fileIndex", fileIdx))
+			pending = append(pending, fileIdx)
+		default:
+			done(f.result(), nil)
+		}
+	}
+
+	var eg errgroup.Group
+	eg.SetLimit(options.workers)
+	for _, fileIdx := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+
+		fileIdx := fileIdx
+		eg.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			info := statInitFile(initOpts.DataDir, fileIdx)
+			start := time.Now()
+			err := options.verifyFile(initOpts.DataDir, fileIdx, options.fraction, initOpts.Scrypt, logger)
+			result := FileVerifyResult{FileIndex: fileIdx, Err: err, Duration: time.Since(start)}
+			if err != nil {
+				logger.Warn("file failed verification", zap.Int("fileIndex", fileIdx), zap.Error(err))
+			} else {
+				logger.Debug("file verified", zap.Int("fileIndex", fileIdx), zap.Duration("duration", result.Duration))
+			}
+			done(result, info)
+			return nil
+		})
+	}
+	eg.Wait()
+
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].FileIndex < report.Files[j].FileIndex })
+	report.Duration = time.Since(started)
+	return report, ctx.Err()
+}
+
+// verifyPosState is the content of the state file of VerifyPos.
+type verifyPosState struct {
+	NodeId          []byte
+	CommitmentAtxId []byte
+	Fraction        float64
+	Scrypt          config.ScryptParams
+	// Files are the results of the verified files. Files that couldn't be verified are not recorded.
+	Files []verifyPosStateFile
+}
+
+type verifyPosStateFile struct {
+	FileIndex int
+	// Size and ModTime are the state of the file when it was verified.
+	Size    int64
+	ModTime time.Time
+	// Invalid is the error of an invalid file, empty if the file is valid.
+	Invalid string `json:",omitempty"`
+}
+
+// loadVerifyPosState loads the state from `path` if it exists and was recorded for the same data and params as
+// `state`. Otherwise `state` is returned.
+func loadVerifyPosState(path string, state *verifyPosState, logger *zap.Logger) (*verifyPosState, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return state, nil
+	case err != nil:
+		return nil, fmt.Errorf("read verification state: %w", err)
+	}
+
+	loaded := &verifyPosState{}
+	if err := json.Unmarshal(data, loaded); err != nil {
+		return nil, fmt.Errorf("decode verification state from %s: %w", path, err)
+	}
+	if !bytes.Equal(loaded.NodeId, state.NodeId) ||
+		!bytes.Equal(loaded.CommitmentAtxId, state.CommitmentAtxId) ||
+		loaded.Fraction != state.Fraction ||
+		loaded.Scrypt != state.Scrypt {
+		logger.Info("verification state was recorded with different params, starting over", zap.String("path", path))
+		return state, nil
+	}
+	logger.Info("resuming verification", zap.String("path", path), zap.Int("verifiedFiles", len(loaded.Files)))
+	return loaded, nil
+}
+
+// file returns the recorded result of the file `fileIdx`, nil if it wasn't verified.
+func (s *verifyPosState) file(fileIdx int) *verifyPosStateFile {
+	for i := range s.Files {
+		if s.Files[i].FileIndex == fileIdx {
+			return &s.Files[i]
+		}
+	}
+	return nil
+}
+
+// add records `result` of the file in state `info` unless the file couldn't be verified or stat'ed.
+func (s *verifyPosState) add(result FileVerifyResult, info fs.FileInfo) {
+	if info == nil || (result.Err != nil && !errors.Is(result.Err, ErrInvalidPos)) {
+		return
+	}
+	f := verifyPosStateFile{FileIndex: result.FileIndex, Size: info.Size(), ModTime: info.ModTime()}
+	if result.Err != nil {
+		f.Invalid = result.Err.Error()
+	}
+	if prev := s.file(result.FileIndex); prev != nil {
+		*prev = f
+		return
+	}
+	s.Files = append(s.Files, f)
+}
+
+func (s *verifyPosState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode verification state: %w", err)
+	}
+	return atomic.WriteFile(path, bytes.NewBuffer(data))
+}
+
+// resumedInvalidPosError is the error of an invalid file loaded from the state file.
+type resumedInvalidPosError string
+
+func (e resumedInvalidPosError) Error() string {
+	return string(e)
+}
+
+func (e resumedInvalidPosError) Unwrap() error {
+	return ErrInvalidPos
+}
+
+// changed returns whether the file in state `info` isn't the file that was verified. `info` is nil if the file
+// couldn't be stat'ed.
+func (f *verifyPosStateFile) changed(info fs.FileInfo) bool {
+	return info == nil || info.Size() != f.Size || !info.ModTime().Equal(f.ModTime)
+}
+
+// result returns the recorded result of the file.
+func (f *verifyPosStateFile) result() FileVerifyResult {
+	result := FileVerifyResult{FileIndex: f.FileIndex, Resumed: true}
+	if f.Invalid != "" {
+		result.Err = resumedInvalidPosError(f.Invalid)
+	}
+	return result
+}
+
+// statInitFile returns the state of the file `fileIdx` in `datadir`, nil if it can't be stat'ed.
+func statInitFile(datadir string, fileIdx int) fs.FileInfo {
+	info, err := os.Stat(filepath.Join(datadir, shared.InitFileName(fileIdx)))
+	if err != nil {
+		return nil
+	}
+	return info
+}
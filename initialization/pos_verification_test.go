@@ -2,14 +2,21 @@ package initialization
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 
+	"github.com/spacemeshos/post/config"
 	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
 )
 
 func TestVerifyPos(t *testing.T) {
@@ -50,3 +57,190 @@ func TestVerifyPos(t *testing.T) {
 		require.ErrorIs(t, err, postrs.ErrInvalidPos)
 	})
 }
+
+func initVerifyPosTestData(t *testing.T) InitOpts {
+	cfg, opts := getTestConfig(t)
+	opts.NumUnits = 3
+	opts.MaxFileSize = 256 * postrs.LabelLength // 6 files
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+	return opts
+}
+
+// fakeFileVerifier fails file 2 as invalid and file 4 with another error.
+type fakeFileVerifier struct {
+	mtx      sync.Mutex
+	verified []int
+	running  int
+	max      int
+}
+
+func (f *fakeFileVerifier) verify(_ string, fileIdx int, _ float64, _ config.ScryptParams, _ *zap.Logger) error {
+	f.mtx.Lock()
+	f.verified = append(f.verified, fileIdx)
+	f.running++
+	f.max = max(f.max, f.running)
+	f.mtx.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	f.mtx.Lock()
+	f.running--
+	f.mtx.Unlock()
+	switch fileIdx {
+	case 2:
+		return fmt.Errorf("%w: file 2 contains invalid label at offset 16", postrs.ErrInvalidPos)
+	case 4:
+		return postrs.ErrInvalidArgument
+	}
+	return nil
+}
+
+func TestVerifyPosFiles(t *testing.T) {
+	opts := initVerifyPosTestData(t)
+
+	t.Run("valid", func(t *testing.T) {
+		report, err := VerifyPos(context.Background(), opts, VerifyPosWithFraction(100), VerifyPosWithWorkers(3))
+		require.NoError(t, err)
+		require.True(t, report.Valid())
+		require.Len(t, report.Files, 6)
+		require.Equal(t, 6, report.Total)
+	})
+
+	t.Run("aggregates results", func(t *testing.T) {
+		fake := &fakeFileVerifier{}
+		var progress []VerifyPosProgress
+		report, err := VerifyPos(context.Background(), opts,
+			VerifyPosWithWorkers(3),
+			VerifyPosWithProgress(func(p VerifyPosProgress) { progress = append(progress, p) }),
+			verifyPosWithFileVerifier(fake.verify),
+		)
+		require.NoError(t, err)
+		require.False(t, report.Valid())
+		require.Len(t, report.Files, 6)
+		for i, f := range report.Files {
+			require.Equal(t, i, f.FileIndex)
+		}
+		failed := report.Failed()
+		require.Len(t, failed, 2)
+		require.Equal(t, 2, failed[0].FileIndex)
+		require.ErrorIs(t, failed[0].Err, ErrInvalidPos)
+		require.Equal(t, 4, failed[1].FileIndex)
+		require.ErrorIs(t, failed[1].Err, postrs.ErrInvalidArgument)
+
+		require.Len(t, progress, 6)
+		for i, p := range progress {
+			require.Equal(t, i+1, p.Verified)
+			require.Equal(t, 6, p.Total)
+		}
+		require.Equal(t, 2, progress[5].Failed)
+		require.LessOrEqual(t, fake.max, 3)
+		require.Greater(t, fake.max, 1)
+	})
+
+	t.Run("only the given files", func(t *testing.T) {
+		fake := &fakeFileVerifier{}
+		opts := opts
+		opts.FromFileIdx = 1
+		opts.ToFileIdx = new(int)
+		*opts.ToFileIdx = 3
+		report, err := VerifyPos(context.Background(), opts, verifyPosWithFileVerifier(fake.verify))
+		require.NoError(t, err)
+		require.Equal(t, 3, report.Total)
+		require.Equal(t, []int{1, 2, 3}, fake.verified)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := VerifyPos(context.Background(), opts, VerifyPosWithFraction(0))
+		require.ErrorContains(t, err, "invalid `fraction`")
+		_, err = VerifyPos(context.Background(), opts, VerifyPosWithWorkers(0))
+		require.ErrorContains(t, err, "invalid `workers`")
+	})
+}
+
+func TestVerifyPosFiles_Resume(t *testing.T) {
+	opts := initVerifyPosTestData(t)
+	stateFile := filepath.Join(t.TempDir(), "verify.json")
+
+	// interrupt the verification after 3 files
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &fakeFileVerifier{}
+	report, err := VerifyPos(ctx, opts,
+		VerifyPosWithStateFile(stateFile),
+		VerifyPosWithProgress(func(p VerifyPosProgress) {
+			if p.Verified == 3 {
+				cancel()
+			}
+		}),
+		verifyPosWithFileVerifier(fake.verify),
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, report.Files, 3)
+	require.False(t, report.Valid())
+	require.Equal(t, []int{0, 1, 2}, fake.verified)
+
+	// the second run only verifies the remaining files
+	fake = &fakeFileVerifier{}
+	var resumed atomic.Int32
+	report, err = VerifyPos(context.Background(), opts,
+		VerifyPosWithStateFile(stateFile),
+		VerifyPosWithProgress(func(p VerifyPosProgress) {
+			if p.Result.Resumed {
+				resumed.Add(1)
+			}
+		}),
+		verifyPosWithFileVerifier(fake.verify),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 4, 5}, fake.verified)
+	require.EqualValues(t, 3, resumed.Load())
+	require.Len(t, report.Files, 6)
+	require.True(t, report.Files[2].Resumed)
+	require.ErrorIs(t, report.Files[2].Err, ErrInvalidPos)
+	require.ErrorContains(t, report.Files[2].Err, "file 2 contains invalid label")
+
+	// file 4 couldn't be verified, so it is verified again
+	fake = &fakeFileVerifier{}
+	_, err = VerifyPos(context.Background(), opts,
+		VerifyPosWithStateFile(stateFile),
+		verifyPosWithFileVerifier(fake.verify),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []int{4}, fake.verified)
+
+	// files that changed since they were verified, e.g. by a repair, are verified again
+	modTime := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(opts.DataDir, shared.InitFileName(0)), modTime, modTime))
+	f, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(3)), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, postrs.LabelLength))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	fake = &fakeFileVerifier{}
+	report, err = VerifyPos(context.Background(), opts,
+		VerifyPosWithStateFile(stateFile),
+		verifyPosWithFileVerifier(fake.verify),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 3, 4}, fake.verified)
+	require.False(t, report.Files[0].Resumed)
+	require.True(t, report.Files[1].Resumed)
+
+	// a different fraction starts over
+	fake = &fakeFileVerifier{}
+	_, err = VerifyPos(context.Background(), opts,
+		VerifyPosWithStateFile(stateFile),
+		VerifyPosWithFraction(1),
+		verifyPosWithFileVerifier(fake.verify),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5}, fake.verified)
+}
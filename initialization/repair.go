@@ -0,0 +1,287 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/shared"
+)
+
+// RepairResult is the result of Repair.
+type RepairResult struct {
+	// Repaired is the number of labels that were rewritten.
+	Repaired uint64
+	// Nonce and NonceValue are set if a repaired label is a better nonce than the one in the metadata.
+	// The metadata has been updated with it.
+	Nonce      *uint64
+	NonceValue []byte
+}
+
+type repairOpts struct {
+	logger            *zap.Logger
+	powDifficultyFunc func(uint64) []byte
+}
+
+// RepairOptionFunc is an option of Repair.
+type RepairOptionFunc func(*repairOpts)
+
+// RepairWithLogger sets the logger Repair reports its progress to.
+func RepairWithLogger(logger *zap.Logger) RepairOptionFunc {
+	return func(opts *repairOpts) {
+		opts.logger = logger
+	}
+}
+
+func repairWithPowDifficultyFunc(powDifficultyFunc func(uint64) []byte) RepairOptionFunc {
+	return func(opts *repairOpts) {
+		opts.powDifficultyFunc = powDifficultyFunc
+	}
+}
+
+// Repair recomputes the labels in `ranges` and overwrites them in place in the PoST data in `initOpts.DataDir`,
+// e.g. the invalid ranges found by ScanPos. Labels are computed with the provider `initOpts.ProviderID` (the CPU if
+// not set) and `initOpts.Scrypt`. Missing files are created.
+//
+// After writing, the repaired labels are read back from disk and verified against labels computed on the CPU. If a
+// repaired label is a better nonce than the one in the metadata, the metadata is updated.
+func Repair(
+	ctx context.Context,
+	initOpts InitOpts,
+	ranges []LabelRange,
+	opts ...RepairOptionFunc,
+) (*RepairResult, error) {
+	options := repairOpts{
+		logger:            zap.NewNop(),
+		powDifficultyFunc: shared.PowDifficulty,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	logger := options.logger
+
+	metadata, err := LoadMetadata(initOpts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+	labelsPerFile := metadata.MaxFileSize / postrs.LabelLength
+	if labelsPerFile == 0 {
+		return nil, fmt.Errorf("invalid `MaxFileSize` in metadata; expected: >= %d, given: %d",
+			postrs.LabelLength, metadata.MaxFileSize,
+		)
+	}
+	totalLabels := metadata.LabelsPerUnit * uint64(metadata.NumUnits)
+	for _, r := range ranges {
+		if r.Start >= r.End || r.End > totalLabels {
+			return nil, fmt.Errorf("invalid range [%d, %d); expected: start < end <= %d", r.Start, r.End, totalLabels)
+		}
+	}
+
+	batchSize := initOpts.ComputeBatchSize
+	if batchSize == 0 {
+		batchSize = config.DefaultComputeBatchSize
+	}
+
+	cpuProviderID := CPUProviderID()
+	providerID := initOpts.ProviderID
+	if providerID == nil {
+		providerID = &cpuProviderID
+	}
+	commitment := oracle.CommitmentBytes(metadata.NodeId, metadata.CommitmentAtxId)
+	difficulty := options.powDifficultyFunc(totalLabels)
+	wo, err := oracle.New(
+		oracle.WithProviderID(providerID),
+		oracle.WithCommitment(commitment),
+		oracle.WithVRFDifficulty(difficulty),
+		oracle.WithScryptParams(initOpts.Scrypt),
+		oracle.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer wo.Close()
+
+	woReference := wo
+	if *providerID != cpuProviderID {
+		woReference, err = oracle.New(
+			oracle.WithProviderID(&cpuProviderID),
+			oracle.WithCommitment(commitment),
+			oracle.WithVRFDifficulty(difficulty),
+			oracle.WithScryptParams(initOpts.Scrypt),
+			oracle.WithLogger(logger),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer woReference.Close()
+	}
+
+	r := &repairer{
+		datadir:       initOpts.DataDir,
+		labelsPerFile: labelsPerFile,
+		batchSize:     batchSize,
+		wo:            wo,
+		woReference:   woReference,
+		commitment:    commitment,
+		nonceValue:    metadata.NonceValue,
+		logger:        logger,
+	}
+	files := splitByFile(ranges, labelsPerFile)
+	fileIndices := make([]int, 0, len(files))
+	for fileIdx := range files {
+		fileIndices = append(fileIndices, fileIdx)
+	}
+	sort.Ints(fileIndices)
+
+	result := &RepairResult{}
+	for _, fileIdx := range fileIndices {
+		fileRanges := files[fileIdx]
+		logger.Info("repairing labels",
+			zap.String("file", shared.InitFileName(fileIdx)),
+			zap.Int("ranges", len(fileRanges)),
+		)
+		repaired, err := r.repairFile(ctx, fileIdx, fileRanges)
+		result.Repaired += repaired
+		if err != nil {
+			return result, fmt.Errorf("repairing %s: %w", shared.InitFileName(fileIdx), err)
+		}
+	}
+
+	if r.nonce != nil {
+		if err := persistNonce(*r.nonce, r.nonceValue, metadata, initOpts.DataDir, logger); err != nil {
+			return result, err
+		}
+		result.Nonce = r.nonce
+		result.NonceValue = r.nonceValue
+	}
+	return result, nil
+}
+
+// splitByFile sorts `ranges` and splits them at the boundaries of the files holding `labelsPerFile` labels.
+func splitByFile(ranges []LabelRange, labelsPerFile uint64) map[int][]LabelRange {
+	sorted := make([]LabelRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	files := make(map[int][]LabelRange)
+	for _, r := range sorted {
+		for start := r.Start; start < r.End; {
+			fileIdx := int(start / labelsPerFile)
+			end := min(r.End, uint64(fileIdx+1)*labelsPerFile)
+			files[fileIdx] = append(files[fileIdx], LabelRange{Start: start, End: end})
+			start = end
+		}
+	}
+	return files
+}
+
+// repairer rewrites labels and keeps track of the best nonce among them.
+type repairer struct {
+	datadir       string
+	labelsPerFile uint64
+	batchSize     uint64
+
+	wo, woReference *oracle.WorkOracle
+	commitment      []byte
+
+	// nonce is the best nonce found among the repaired labels, nonceValue its label or the label of the nonce
+	// in the metadata if no better one was found.
+	nonce      *uint64
+	nonceValue []byte
+
+	logger *zap.Logger
+}
+
+func (r *repairer) repairFile(ctx context.Context, fileIdx int, ranges []LabelRange) (uint64, error) {
+	f, err := os.OpenFile(filepath.Join(r.datadir, shared.InitFileName(fileIdx)), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	first := uint64(fileIdx) * r.labelsPerFile
+	buf := make([]byte, r.batchSize*postrs.LabelLength)
+	var repaired uint64
+	for _, lr := range ranges {
+		for start := lr.Start; start < lr.End; start += r.batchSize {
+			end := min(start+r.batchSize, lr.End)
+			res, err := r.wo.PositionsIntoContext(ctx, buf, start, end-1)
+			if err != nil {
+				return repaired, fmt.Errorf("failed to compute labels: %w", err)
+			}
+			if _, err := f.WriteAt(res.Output, int64((start-first)*postrs.LabelLength)); err != nil {
+				return repaired, err
+			}
+			repaired += end - start
+			if res.Nonce != nil {
+				r.nonceCandidate(*res.Nonce, labelAt(res.Output, start, *res.Nonce))
+			}
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return repaired, err
+	}
+
+	// read the repaired labels back and verify them
+	for _, lr := range ranges {
+		for start := lr.Start; start < lr.End; start += r.batchSize {
+			end := min(start+r.batchSize, lr.End)
+			stored := buf[:(end-start)*postrs.LabelLength]
+			n, err := f.ReadAt(stored, int64((start-first)*postrs.LabelLength))
+			if err != nil && !errors.Is(err, io.EOF) {
+				return repaired, err
+			}
+			reference, err := r.woReference.PositionsContext(ctx, start, end-1)
+			if err != nil {
+				return repaired, fmt.Errorf("failed to compute reference labels: %w", err)
+			}
+			for i := uint64(0); i < end-start; i++ {
+				expected := labelAt(reference.Output, start, start+i)
+				var actual []byte
+				if (i+1)*postrs.LabelLength <= uint64(n) {
+					actual = labelAt(stored, start, start+i)
+				}
+				if !bytes.Equal(actual, expected) {
+					return repaired, ErrReferenceLabelMismatch{
+						Index:      start + i,
+						Commitment: r.commitment,
+						Expected:   expected,
+						Actual:     actual,
+					}
+				}
+			}
+		}
+	}
+	return repaired, nil
+}
+
+// nonceCandidate records the label at `index` as the best nonce if it is lower than the best one so far.
+func (r *repairer) nonceCandidate(index uint64, label []byte) {
+	if r.nonceValue != nil && bytes.Compare(label, r.nonceValue) >= 0 {
+		return
+	}
+	r.logger.Debug("found nonce among repaired labels",
+		zap.Uint64("nonce", index),
+		zap.String("value", hex.EncodeToString(label)),
+	)
+	r.nonce = &index
+	r.nonceValue = make([]byte, postrs.LabelLength)
+	copy(r.nonceValue, label)
+}
+
+// labelAt returns the label at `index` of `labels` starting at `start`.
+func labelAt(labels []byte, start, index uint64) []byte {
+	offset := (index - start) * postrs.LabelLength
+	return labels[offset : offset+postrs.LabelLength]
+}
@@ -0,0 +1,129 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+func initRepairTestData(t *testing.T) InitOpts {
+	cfg, opts := getTestConfig(t)
+	cfg.LabelsPerUnit = 4072
+	opts.NumUnits = 2
+	opts.MaxFileSize = 3000 * postrs.LabelLength // 3000, 3000 and 2144 labels per file
+	opts.ComputeBatchSize = 512
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+	return opts
+}
+
+func TestRepair(t *testing.T) {
+	opts := initRepairTestData(t)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	before, err := LoadMetadata(opts.DataDir)
+	require.NoError(t, err)
+
+	// corrupt labels 10-19 and 1500 of file 0, truncate the last 100 labels of file 1 and remove file 2
+	f, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, 10*postrs.LabelLength), 10*postrs.LabelLength)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, postrs.LabelLength), 1500*postrs.LabelLength)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Truncate(filepath.Join(opts.DataDir, shared.InitFileName(1)), 2900*postrs.LabelLength))
+	require.NoError(t, os.Remove(filepath.Join(opts.DataDir, shared.InitFileName(2))))
+
+	report, err := ScanPos(context.Background(), opts, ScanWithFraction(100))
+	require.NoError(t, err)
+	require.False(t, report.Valid())
+
+	result, err := Repair(context.Background(), opts, report.InvalidRanges(), RepairWithLogger(logger))
+	require.NoError(t, err)
+	require.EqualValues(t, 11+100+2144, result.Repaired)
+	require.Nil(t, result.Nonce)
+
+	report, err = ScanPos(context.Background(), opts, ScanWithFraction(100))
+	require.NoError(t, err)
+	require.True(t, report.Valid())
+	for _, f := range report.Files {
+		require.Equal(t, f.NumLabels, f.Sampled)
+	}
+
+	// the nonce is unchanged
+	after, err := LoadMetadata(opts.DataDir)
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+}
+
+func TestRepair_UpdatesNonce(t *testing.T) {
+	opts := initRepairTestData(t)
+
+	// replace the nonce with a worse one
+	metadata, err := LoadMetadata(opts.DataDir)
+	require.NoError(t, err)
+	metadata.Nonce = new(uint64)
+	metadata.NonceValue = bytes.Repeat([]byte{0xff}, postrs.LabelLength)
+	require.NoError(t, SaveMetadata(opts.DataDir, metadata))
+
+	// every label is a nonce candidate
+	difficulty := func(uint64) []byte { return bytes.Repeat([]byte{0xff}, 32) }
+	ranges := []LabelRange{{Start: 2000, End: 4000}}
+	result, err := Repair(context.Background(), opts, ranges, repairWithPowDifficultyFunc(difficulty))
+	require.NoError(t, err)
+	require.EqualValues(t, 2000, result.Repaired)
+	require.NotNil(t, result.Nonce)
+	require.GreaterOrEqual(t, *result.Nonce, uint64(2000))
+	require.Less(t, *result.Nonce, uint64(4000))
+
+	metadata, err = LoadMetadata(opts.DataDir)
+	require.NoError(t, err)
+	require.Equal(t, *result.Nonce, *metadata.Nonce)
+	require.Equal(t, shared.NonceValue(result.NonceValue), metadata.NonceValue)
+
+	// the nonce is the lowest label of the range
+	labels := make([]byte, 0, 2000*postrs.LabelLength)
+	data, err := os.ReadFile(filepath.Join(opts.DataDir, shared.InitFileName(0)))
+	require.NoError(t, err)
+	labels = append(labels, data[2000*postrs.LabelLength:]...)
+	data, err = os.ReadFile(filepath.Join(opts.DataDir, shared.InitFileName(1)))
+	require.NoError(t, err)
+	labels = append(labels, data[:1000*postrs.LabelLength]...)
+	for i := uint64(0); i < 2000; i++ {
+		label := labels[i*postrs.LabelLength : (i+1)*postrs.LabelLength]
+		require.GreaterOrEqual(t, bytes.Compare(label, result.NonceValue), 0)
+		if 2000+i == *result.Nonce {
+			require.Equal(t, result.NonceValue, label)
+		}
+	}
+
+	// repairing again doesn't find a better nonce
+	result, err = Repair(context.Background(), opts, ranges, repairWithPowDifficultyFunc(difficulty))
+	require.NoError(t, err)
+	require.Nil(t, result.Nonce)
+}
+
+func TestRepair_InvalidRange(t *testing.T) {
+	opts := initRepairTestData(t)
+
+	_, err := Repair(context.Background(), opts, []LabelRange{{Start: 10, End: 10}})
+	require.ErrorContains(t, err, "invalid range")
+	_, err = Repair(context.Background(), opts, []LabelRange{{Start: 8000, End: 8145}})
+	require.ErrorContains(t, err, "invalid range")
+}
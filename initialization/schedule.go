@@ -0,0 +1,225 @@
+package initialization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errOutsideSchedule = errors.New("outside of schedule window")
+
+// Clock provides the current time and timers to an Initializer with a Schedule.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after the duration d elapsed. The returned function stops the timer and reports whether
+	// it was stopped before f was called.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// DailyWindow is a time window that repeats every day. Start and End are wall clock times of day, given as the
+// time since midnight, in the location of the clock. On days with a daylight saving time change they are still the
+// wall clock times, not the time elapsed since midnight. If End is before Start the window spans midnight.
+type DailyWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w DailyWindow) validate() error {
+	const day = 24 * time.Hour
+	if w.Start < 0 || w.Start > day || w.End < 0 || w.End > day {
+		return fmt.Errorf("invalid window %v; expected: start and end within [0, 24h]", w)
+	}
+	if w.Start == w.End {
+		return fmt.Errorf("invalid window %v; expected: start != end", w)
+	}
+	return nil
+}
+
+func (w DailyWindow) String() string {
+	return fmt.Sprintf("%s-%s", formatTimeOfDay(w.Start), formatTimeOfDay(w.End))
+}
+
+func (w DailyWindow) contains(t time.Time) bool {
+	offset := timeOfDay(t)
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// Schedule is a set of daily time windows in which an Initializer is allowed to compute labels.
+type Schedule struct {
+	windows []DailyWindow
+}
+
+// NewSchedule returns a Schedule that allows initialization within any of the given windows.
+func NewSchedule(windows ...DailyWindow) (*Schedule, error) {
+	if len(windows) == 0 {
+		return nil, errors.New("at least one window is required")
+	}
+	for _, w := range windows {
+		if err := w.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Schedule{windows: windows}, nil
+}
+
+// ParseSchedule parses a comma separated list of daily windows in the format `HH:MM-HH:MM`,
+// e.g. "22:00-06:00,12:00-13:30".
+func ParseSchedule(s string) (*Schedule, error) {
+	var windows []DailyWindow
+	for _, part := range strings.Split(s, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q; expected: HH:MM-HH:MM", part)
+		}
+
+		var w DailyWindow
+		var err error
+		if w.Start, err = parseTimeOfDay(start); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		if w.End, err = parseTimeOfDay(end); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		windows = append(windows, w)
+	}
+	return NewSchedule(windows...)
+}
+
+func (s *Schedule) String() string {
+	windows := make([]string, 0, len(s.windows))
+	for _, w := range s.windows {
+		windows = append(windows, w.String())
+	}
+	return strings.Join(windows, ",")
+}
+
+// Active returns whether `t` is within one of the windows of the schedule.
+func (s *Schedule) Active(t time.Time) bool {
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange returns the first time after `t` at which Active changes. It returns false if Active never changes,
+// because the windows cover the whole day.
+func (s *Schedule) NextChange(t time.Time) (time.Time, bool) {
+	var boundaries []time.Time
+	for day := -1; day <= 1; day++ {
+		d := t.AddDate(0, 0, day)
+		for _, w := range s.windows {
+			boundaries = append(boundaries, atTimeOfDay(d, w.Start), atTimeOfDay(d, w.End))
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	active := s.Active(t)
+	for _, b := range boundaries {
+		if b.After(t) && s.Active(b) != active {
+			return b, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeOfDay returns the wall clock time of `t` as the time since midnight.
+func timeOfDay(t time.Time) time.Duration {
+	hour, minute, sec := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(sec)*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+// atTimeOfDay returns the time at the wall clock time `offset` on the day of `t`. An offset of 24h is midnight of
+// the next day.
+func atTimeOfDay(t time.Time, offset time.Duration) time.Time {
+	hours, minutes := int(offset/time.Hour), int(offset%time.Hour/time.Minute)
+	return time.Date(t.Year(), t.Month(), t.Day(), hours, minutes, 0, 0, t.Location())
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hours, &minutes); err != nil {
+		return 0, fmt.Errorf("invalid time of day %q; expected: HH:MM", s)
+	}
+	if hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time of day %q; expected: 00:00 to 24:00", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// initializeScheduled runs the initialization within the windows of the schedule. Every window starts a new run
+// that continues where the previous one stopped, so the work oracles are closed in between.
+func (init *Initializer) initializeScheduled(ctx context.Context) error {
+	for {
+		now := init.clock.Now()
+		next, changes := init.schedule.NextChange(now)
+		if !init.schedule.Active(now) {
+			init.logger.Info("initialization: waiting for schedule window",
+				zap.Stringer("schedule", init.schedule),
+				zap.Time("start", next),
+			)
+			init.hooks.phaseChanged(PhaseWaiting)
+			if err := init.waitUntil(ctx, next); err != nil {
+				return err
+			}
+			continue
+		}
+
+		windowCtx, cancel := context.WithCancelCause(ctx)
+		stop := func() bool { return false }
+		if changes {
+			stop = init.clock.AfterFunc(next.Sub(now), func() { cancel(errOutsideSchedule) })
+		}
+		err := init.initialize(windowCtx)
+		stop()
+		cancel(nil)
+
+		windowEnded := errors.Is(context.Cause(windowCtx), errOutsideSchedule)
+		if ctx.Err() == nil && errors.Is(err, context.Canceled) && windowEnded {
+			init.logger.Info("initialization: schedule window ended, pausing",
+				zap.Uint64("numLabelsWritten", init.NumLabelsWritten()),
+			)
+			continue
+		}
+		return err
+	}
+}
+
+// waitUntil blocks until the clock reaches `t` or the context is canceled.
+func (init *Initializer) waitUntil(ctx context.Context, t time.Time) error {
+	done := make(chan struct{})
+	stop := init.clock.AfterFunc(t.Sub(init.clock.Now()), func() { close(done) })
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		init.logger.Info("initialization: stopped")
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
@@ -0,0 +1,249 @@
+package initialization
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeTimer struct {
+	at   time.Time
+	f    func()
+	done bool
+}
+
+// fakeClock is a Clock that only advances when Set is called. Timers that expire are called synchronously by Set.
+type fakeClock struct {
+	mtx    sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	if d <= 0 {
+		f()
+		return func() bool { return false }
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		stopped := !t.done
+		t.done = true
+		return stopped
+	}
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mtx.Lock()
+	c.now = now
+	var expired []*fakeTimer
+	for _, t := range c.timers {
+		if !t.done && !t.at.After(now) {
+			t.done = true
+			expired = append(expired, t)
+		}
+	}
+	c.mtx.Unlock()
+
+	for _, t := range expired {
+		t.f()
+	}
+}
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, time.January, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestSchedule_Active(t *testing.T) {
+	s, err := ParseSchedule("22:00-06:00, 12:00-13:30")
+	require.NoError(t, err)
+	require.Equal(t, "22:00-06:00,12:00-13:30", s.String())
+
+	for _, tc := range []struct {
+		time   time.Time
+		active bool
+		next   time.Time
+	}{
+		{at(1, 21, 59), false, at(1, 22, 0)},
+		{at(1, 22, 0), true, at(2, 6, 0)},
+		{at(1, 23, 59), true, at(2, 6, 0)},
+		{at(2, 0, 0), true, at(2, 6, 0)},
+		{at(2, 6, 0), false, at(2, 12, 0)},
+		{at(2, 12, 30), true, at(2, 13, 30)},
+		{at(2, 13, 30), false, at(2, 22, 0)},
+	} {
+		require.Equal(t, tc.active, s.Active(tc.time), tc.time)
+		next, ok := s.NextChange(tc.time)
+		require.True(t, ok)
+		require.Equal(t, tc.next, next, tc.time)
+	}
+}
+
+func TestSchedule_AdjacentWindows(t *testing.T) {
+	s, err := ParseSchedule("20:00-24:00,00:00-02:00,02:00-04:00")
+	require.NoError(t, err)
+
+	next, ok := s.NextChange(at(1, 21, 0))
+	require.True(t, ok)
+	require.Equal(t, at(2, 4, 0), next)
+
+	s, err = ParseSchedule("00:00-12:00,12:00-24:00")
+	require.NoError(t, err)
+	require.True(t, s.Active(at(1, 12, 0)))
+	_, ok = s.NextChange(at(1, 12, 0))
+	require.False(t, ok)
+}
+
+func TestSchedule_DaylightSavingTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, loc)
+	}
+
+	s, err := ParseSchedule("06:00-07:00,23:00-01:00")
+	require.NoError(t, err)
+
+	// the clocks are set forward from 02:00 to 03:00 on March 10 and back from 02:00 to 01:00 on November 3,
+	// the windows still start and end at the wall clock times.
+	for _, tc := range []struct {
+		time   time.Time
+		active bool
+		next   time.Time
+	}{
+		{at(time.March, 10, 1, 30), false, at(time.March, 10, 6, 0)},
+		{at(time.March, 10, 6, 30), true, at(time.March, 10, 7, 0)},
+		{at(time.March, 10, 7, 0), false, at(time.March, 10, 23, 0)},
+		{at(time.March, 10, 23, 30), true, at(time.March, 11, 1, 0)},
+		{at(time.November, 2, 23, 30), true, at(time.November, 3, 1, 0)},
+		{at(time.November, 3, 1, 30), false, at(time.November, 3, 6, 0)},
+		{at(time.November, 3, 6, 30), true, at(time.November, 3, 7, 0)},
+		{at(time.November, 3, 7, 0), false, at(time.November, 3, 23, 0)},
+	} {
+		require.Equal(t, tc.active, s.Active(tc.time), tc.time)
+		next, ok := s.NextChange(tc.time)
+		require.True(t, ok)
+		require.Equal(t, tc.next, next, tc.time)
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"22:00",
+		"22:00-22:00",
+		"25:00-06:00",
+		"22:60-06:00",
+		"24:30-06:00",
+		"ab:cd-06:00",
+	} {
+		_, err := ParseSchedule(s)
+		require.Error(t, err, s)
+	}
+
+	_, err := NewSchedule()
+	require.Error(t, err)
+}
+
+func TestInitialize_Schedule(t *testing.T) {
+	r := require.New(t)
+
+	cfg, opts := getTestConfig(t)
+	opts.NumUnits = 4
+	opts.MaxFileSize = cfg.UnitSize()
+
+	schedule, err := ParseSchedule("01:00-02:00")
+	r.NoError(err)
+	clock := &fakeClock{now: at(1, 0, 30)}
+
+	phases := make(chan Phase, 10)
+	var init *Initializer
+	init, err = NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithSchedule(schedule),
+		WithClock(clock),
+		OnPhaseChange(func(phase Phase) { phases <- phase }),
+		OnFileCompleted(func(index int, numLabels uint64) {
+			if index == 0 {
+				// the window ends while the first file is written
+				clock.Set(at(1, 2, 0))
+			}
+		}),
+	)
+	r.NoError(err)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- init.Initialize(context.Background()) }()
+
+	// outside of the window nothing is initialized
+	r.Equal(PhaseWaiting, <-phases)
+	r.Zero(init.NumLabelsWritten())
+
+	// the window starts and ends after the first file
+	clock.Set(at(1, 1, 0))
+	r.Equal(PhaseLabelling, <-phases)
+	r.Equal(PhaseWaiting, <-phases)
+	r.Equal(cfg.LabelsPerUnit, init.NumLabelsWritten())
+
+	numLabelsWritten, err := init.diskState.NumLabelsWritten()
+	r.NoError(err)
+	r.Equal(cfg.LabelsPerUnit, numLabelsWritten)
+
+	// the next window continues where the initialization stopped
+	clock.Set(at(2, 1, 0))
+	r.Equal(PhaseLabelling, <-phases)
+	r.NoError(<-errCh)
+	r.Equal(PhaseDone, <-phases)
+	r.Equal(uint64(opts.NumUnits)*cfg.LabelsPerUnit, init.NumLabelsWritten())
+	r.NotNil(init.Nonce())
+}
+
+func TestInitialize_ScheduleCanceledWhileWaiting(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+
+	schedule, err := ParseSchedule("01:00-02:00")
+	require.NoError(t, err)
+
+	phases := make(chan Phase, 10)
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithSchedule(schedule),
+		WithClock(&fakeClock{now: at(1, 3, 0)}),
+		OnPhaseChange(func(phase Phase) { phases <- phase }),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- init.Initialize(ctx) }()
+
+	require.Equal(t, PhaseWaiting, <-phases)
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	require.Zero(t, init.NumLabelsWritten())
+}
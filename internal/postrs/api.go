@@ -34,6 +34,7 @@ type ScryptPositionsResult struct {
 type Scrypter interface {
 	io.Closer
 	Positions(start, end uint64) (ScryptPositionsResult, error)
+	PositionsInto(dst []byte, start, end uint64) (ScryptPositionsResult, error)
 }
 
 type option struct {
@@ -168,6 +169,18 @@ func (s *Scrypt) Close() error {
 
 // Positions computes the scrypt output for the given options.
 func (s *Scrypt) Positions(start, end uint64) (ScryptPositionsResult, error) {
+	if start > end {
+		return ScryptPositionsResult{},
+			fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
+	}
+
+	return s.PositionsInto(make([]byte, LabelLength*(end-start+1)), start, end)
+}
+
+// PositionsInto computes the scrypt output for the given options and writes it into dst.
+// dst must be large enough to hold LabelLength * (end - start + 1) bytes. The returned
+// Output is a sub-slice of dst and is only valid until dst is reused by the caller.
+func (s *Scrypt) PositionsInto(dst []byte, start, end uint64) (ScryptPositionsResult, error) {
 	if s.init == nil {
 		return ScryptPositionsResult{}, ErrScryptClosed
 	}
@@ -177,13 +190,23 @@ func (s *Scrypt) Positions(start, end uint64) (ScryptPositionsResult, error) {
 			fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
 	}
 
+	outputSize := LabelLength * (end - start + 1)
+	if uint64(len(dst)) < outputSize {
+		return ScryptPositionsResult{},
+			fmt.Errorf("invalid `dst` length; expected: >= %v, given: %v", outputSize, len(dst))
+	}
+
 	if err := s.options.validate(); err != nil {
 		return ScryptPositionsResult{}, err
 	}
 
-	output, idxSolution, err := cScryptPositions(s.init, start, end)
+	output := dst[:outputSize]
+	idxSolution, err := cScryptPositions(s.init, output, start, end)
+	if err != nil {
+		return ScryptPositionsResult{}, err
+	}
 	return ScryptPositionsResult{
 		Output:      output,
 		IdxSolution: idxSolution,
-	}, err
+	}, nil
 }
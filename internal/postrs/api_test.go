@@ -86,6 +86,49 @@ func TestScryptPositions(t *testing.T) {
 	require.NotNil(t, nonce)
 }
 
+func TestScryptPositionsInto(t *testing.T) {
+	vrfDifficulty := make([]byte, 32)
+	copy(vrfDifficulty, defaultDifficulty)
+	vrfDifficulty[0] = 0
+
+	start := uint64(1)
+	end := uint64(1 << 8)
+
+	scrypt, err := NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		WithScryptN(32),
+	)
+	require.NoError(t, err)
+	defer scrypt.Close()
+
+	expected, err := scrypt.Positions(start, end)
+	require.NoError(t, err)
+
+	t.Run("exact buffer", func(t *testing.T) {
+		dst := make([]byte, LabelLength*(end-start+1))
+		res, err := scrypt.PositionsInto(dst, start, end)
+		require.NoError(t, err)
+		require.Equal(t, expected, res)
+		require.Same(t, &dst[0], &res.Output[0])
+	})
+
+	t.Run("larger buffer", func(t *testing.T) {
+		dst := make([]byte, 2*LabelLength*(end-start+1))
+		res, err := scrypt.PositionsInto(dst, start, end)
+		require.NoError(t, err)
+		require.Equal(t, expected, res)
+		require.Len(t, res.Output, LabelLength*int(end-start+1))
+	})
+
+	t.Run("buffer too small", func(t *testing.T) {
+		dst := make([]byte, LabelLength*(end-start))
+		_, err := scrypt.PositionsInto(dst, start, end)
+		require.ErrorContains(t, err, "invalid `dst` length")
+	})
+}
+
 func TestScrypt_Close(t *testing.T) {
 	providers, err := OpenCLProviders()
 	require.NoError(t, err)
@@ -223,3 +266,44 @@ func TestCloseNilScrypt(t *testing.T) {
 	var scrypt *Scrypt
 	scrypt.Close()
 }
+
+func BenchmarkScryptPositions(b *testing.B) {
+	scrypt, err := NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithScryptN(2),
+	)
+	require.NoError(b, err)
+	defer scrypt.Close()
+
+	const batchSize = 1 << 12
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := uint64(i) * batchSize
+		if _, err := scrypt.Positions(start, start+batchSize-1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScryptPositionsInto(b *testing.B) {
+	scrypt, err := NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithScryptN(2),
+	)
+	require.NoError(b, err)
+	defer scrypt.Close()
+
+	const batchSize = 1 << 12
+	dst := make([]byte, LabelLength*batchSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := uint64(i) * batchSize
+		if _, err := scrypt.PositionsInto(dst, start, start+batchSize-1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import "C"
 import (
 	"errors"
 	"sync"
+	"unsafe"
 )
 
 // gpuMtx is a mutual exclusion lock preventing concurrent access
@@ -104,30 +105,26 @@ func cFreeInitializer(init *C.Initializer) {
 }
 
 // cScryptPositions calls the C functions from libpostrs that create the labels
-// and VRF proofs.
-func cScryptPositions(init *C.Initializer, start, end uint64) ([]byte, *uint64, error) {
-	outputSize := LabelLength * (end - start + 1)
+// and VRF proofs. The labels are written directly into `out`, which must be
+// exactly LabelLength * (end - start + 1) bytes long.
+func cScryptPositions(init *C.Initializer, out []byte, start, end uint64) (*uint64, error) {
 	cStartPosition := C.uint64_t(start)
 	cEndPosition := C.uint64_t(end)
-	cOutputSize := C.size_t(outputSize)
-	cOut := (C.malloc(cOutputSize))
-	defer C.free(cOut)
+	cOut := (*C.uint8_t)(unsafe.Pointer(unsafe.SliceData(out)))
 
 	var cIdxSolution C.uint64_t
-	retVal := C.initialize(init, cStartPosition, cEndPosition, (*C.uint8_t)(cOut), &cIdxSolution)
+	retVal := C.initialize(init, cStartPosition, cEndPosition, cOut, &cIdxSolution)
 	if err := InitResultToError(retVal); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	output := C.GoBytes(cOut, C.int(cOutputSize))
-
 	if retVal == C.InitializeResult_OkNonceNotFound {
-		return output, nil, nil
+		return nil, nil
 	}
 
 	vrfNonce := new(uint64)
 	*vrfNonce = uint64(cIdxSolution)
-	return output, vrfNonce, nil
+	return vrfNonce, nil
 }
 
 // cCPUProviderID returns the ID for the (non OpenCL) CPU provider.
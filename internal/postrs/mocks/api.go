@@ -115,3 +115,42 @@ func (c *MockScrypterPositionsCall) DoAndReturn(f func(uint64, uint64) (postrs.S
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
+
+// PositionsInto mocks base method.
+func (m *MockScrypter) PositionsInto(arg0 []byte, arg1, arg2 uint64) (postrs.ScryptPositionsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PositionsInto", arg0, arg1, arg2)
+	ret0, _ := ret[0].(postrs.ScryptPositionsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PositionsInto indicates an expected call of PositionsInto.
+func (mr *MockScrypterMockRecorder) PositionsInto(arg0, arg1, arg2 any) *MockScrypterPositionsIntoCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PositionsInto", reflect.TypeOf((*MockScrypter)(nil).PositionsInto), arg0, arg1, arg2)
+	return &MockScrypterPositionsIntoCall{Call: call}
+}
+
+// MockScrypterPositionsIntoCall wrap *gomock.Call
+type MockScrypterPositionsIntoCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockScrypterPositionsIntoCall) Return(arg0 postrs.ScryptPositionsResult, arg1 error) *MockScrypterPositionsIntoCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockScrypterPositionsIntoCall) Do(f func([]byte, uint64, uint64) (postrs.ScryptPositionsResult, error)) *MockScrypterPositionsIntoCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockScrypterPositionsIntoCall) DoAndReturn(f func([]byte, uint64, uint64) (postrs.ScryptPositionsResult, error)) *MockScrypterPositionsIntoCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
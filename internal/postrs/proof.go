@@ -6,8 +6,10 @@ package postrs
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"sync"
 	"unsafe"
 
@@ -40,6 +42,11 @@ func NewScryptParams(n, r, p uint) ScryptParams {
 // ErrVerifierClosed is returned when calling a method on an already closed Scrypt instance.
 var ErrVerifierClosed = errors.New("verifier has been closed")
 
+// ErrProofAbandoned is returned by GenerateProofContext if `ctx` is canceled after the library started to
+// generate the proof. The returned error also wraps ctx.Err(). The library keeps generating the abandoned proof
+// in the background and its data directory stays busy until it finished.
+var ErrProofAbandoned = errors.New("proof abandoned, libpost keeps generating it in the background")
+
 func GenerateProof(
 	dataDir string,
 	challenge []byte,
@@ -90,6 +97,93 @@ func GenerateProof(
 	}, nil
 }
 
+// generateProof is the call into the library used by GenerateProofContext. Tests replace it to simulate
+// proofs that take a long time.
+var generateProof = GenerateProof
+
+// GenerateProofContext is like GenerateProof but returns as soon as `ctx` is canceled. If the library already
+// started to generate the proof the returned error is ErrProofAbandoned wrapping ctx.Err(), otherwise ctx.Err().
+//
+// The library can't stop a running generate_proof call. Cancellation doesn't stop the work: after `ctx` is
+// canceled the call keeps reading `dataDir` and computing the PoW in the background until it returns, then its
+// proof is freed and discarded. Until then `dataDir` stays busy: GenerateProofContext doesn't start another
+// proof for the same directory while one is running, it waits for it to finish or for `ctx` to be canceled.
+func GenerateProofContext(
+	ctx context.Context,
+	dataDir string,
+	challenge []byte,
+	logger *zap.Logger,
+	nonces, threads, K1, K2 uint,
+	powDifficulty [32]byte,
+	powFlags PowFlags,
+) (*shared.Proof, error) {
+	release, err := acquireDataDir(ctx, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		release()
+		return nil, err
+	}
+
+	type result struct {
+		proof *shared.Proof
+		err   error
+	}
+	// `dataDir` is busy until the library returned, even if `ctx` is canceled before.
+	done := make(chan result, 1)
+	go func() {
+		defer release()
+		proof, err := generateProof(dataDir, challenge, logger, nonces, threads, K1, K2, powDifficulty, powFlags)
+		done <- result{proof, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.proof, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrProofAbandoned, ctx.Err())
+	}
+}
+
+// busyDataDirs are the data directories proofs are generated for. An entry is removed and its channel closed
+// once the library returned for all proofs of the directory.
+var busyDataDirs = struct {
+	sync.Mutex
+	dirs map[string]chan struct{}
+}{dirs: make(map[string]chan struct{})}
+
+// acquireDataDir waits until no proof is generated for `dataDir` and marks it busy. The returned function marks
+// it idle again and must be called exactly once.
+func acquireDataDir(ctx context.Context, dataDir string) (func(), error) {
+	key := filepath.Clean(dataDir)
+	if abs, err := filepath.Abs(dataDir); err == nil {
+		key = abs
+	}
+	for {
+		busyDataDirs.Lock()
+		busy, ok := busyDataDirs.dirs[key]
+		if !ok {
+			idle := make(chan struct{})
+			busyDataDirs.dirs[key] = idle
+			busyDataDirs.Unlock()
+			return func() {
+				busyDataDirs.Lock()
+				delete(busyDataDirs.dirs, key)
+				busyDataDirs.Unlock()
+				close(idle)
+			}, nil
+		}
+		busyDataDirs.Unlock()
+
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
 type PowFlags = C.RandomXFlag
 
 // Get the recommended PoW flags.
@@ -192,6 +286,14 @@ func VerifySubset(k3 uint, seed []byte) VerifyOptionFunc {
 	}
 }
 
+// VerifyProof verifies `proof` with libpost. libpost reports only the kind of a failure, VerifyProof maps it to
+// an error that names the reason where it can be found:
+//   - VerifyResult_Invalid is returned as ProofRejectedError, e.g. for an invalid PoW, or as InvalidMetadataError
+//     or InvalidNumberOfIndicesError, see invalidProofError.
+//   - VerifyResult_InvalidIndex is returned as IndexOutOfRangeError, or as LabelRejectedError if the label of the
+//     index doesn't satisfy the K1 threshold. Both wrap an ErrInvalidIndex.
+//   - VerifyResult_InvalidArgument matches ErrInvalidArgument and wraps the invalid argument, see
+//     invalidArgumentError.
 func (v *Verifier) VerifyProof(
 	proof *shared.Proof,
 	metadata *shared.ProofMetadata,
@@ -210,17 +312,14 @@ func (v *Verifier) VerifyProof(
 	if metadata == nil {
 		return errors.New("metadata cannot be nil")
 	}
-	if len(metadata.NodeId) != 32 {
-		return errors.New("node id length must be 32")
-	}
-	if len(metadata.CommitmentAtxId) != 32 {
-		return errors.New("commitment atx id length must be 32")
-	}
-	if len(metadata.Challenge) != 32 {
-		return errors.New("challenge length must be 32")
+	if err := checkMetadataIDs(metadata); err != nil {
+		return err
 	}
 	if len(proof.Indices) == 0 {
-		return errors.New("proof indices are empty")
+		return InvalidNumberOfIndicesError{
+			Expected:     cfg.K2,
+			ExpectedSize: int(shared.ProofIndicesSize(uint64(metadata.NumUnits)*cfg.LabelsPerUnit, cfg.K2)),
+		}
 	}
 
 	config := C.ProofConfig{
@@ -304,13 +403,15 @@ func (v *Verifier) VerifyProof(
 	switch result.tag {
 	case C.VerifyResult_Ok:
 		return nil
+	case C.VerifyResult_Invalid:
+		return invalidProofError(proof, metadata, cfg)
 	case C.VerifyResult_InvalidIndex:
 		result := castBytes[C.VerifyResult_InvalidIndex_Body](result.anon0[:])
-		return &ErrInvalidIndex{Index: int(result.index_id)}
+		return invalidIndexError(proof, metadata, cfg, int(result.index_id))
 	case C.VerifyResult_InvalidArgument:
-		return errors.New("invalid argument")
+		return invalidArgumentError(proof, metadata, cfg, options)
 	default:
-		return errors.New("unknown error")
+		return fmt.Errorf("%w: verify result %d", ErrUnknown, result.tag)
 	}
 }
 
@@ -0,0 +1,91 @@
+package postrs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// blockingGenerateProof replaces the library call with one that blocks until a value is sent on `release`.
+// `calls` receives a value for every call.
+func blockingGenerateProof(t *testing.T) (calls <-chan struct{}, release chan<- error) {
+	callsCh := make(chan struct{}, 10)
+	releaseCh := make(chan error)
+	original := generateProof
+	generateProof = func(
+		string, []byte, *zap.Logger, uint, uint, uint, uint, [32]byte, PowFlags,
+	) (*shared.Proof, error) {
+		callsCh <- struct{}{}
+		if err := <-releaseCh; err != nil {
+			return nil, err
+		}
+		return &shared.Proof{Nonce: 1}, nil
+	}
+	t.Cleanup(func() { generateProof = original })
+	return callsCh, releaseCh
+}
+
+func TestGenerateProofContext_Canceled(t *testing.T) {
+	calls, release := blockingGenerateProof(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := GenerateProofContext(ctx, "", nil, nil, 1, 1, 1, 1, [32]byte{}, 0)
+		errCh <- err
+	}()
+
+	<-calls
+	cancel()
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, err, ErrProofAbandoned)
+	case <-time.After(time.Second):
+		require.Fail(t, "GenerateProofContext didn't return after ctx was canceled")
+	}
+	release <- nil
+
+	// a canceled context doesn't call the library
+	_, err := GenerateProofContext(ctx, "", nil, nil, 1, 1, 1, 1, [32]byte{}, 0)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotErrorIs(t, err, ErrProofAbandoned)
+	require.Empty(t, calls)
+}
+
+func TestGenerateProofContext_WaitsForCanceledProof(t *testing.T) {
+	calls, release := blockingGenerateProof(t)
+	dataDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := GenerateProofContext(ctx, dataDir, nil, nil, 1, 1, 1, 1, [32]byte{}, 0)
+		errCh <- err
+	}()
+	<-calls
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+
+	// the canceled proof is still generated by the library, the next one for the same directory has to wait
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := GenerateProofContext(ctx, dataDir+"/.", nil, nil, 1, 1, 1, 1, [32]byte{}, 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotErrorIs(t, err, ErrProofAbandoned)
+	require.Empty(t, calls)
+
+	release <- nil
+	go func() {
+		<-calls
+		release <- errors.New("fail")
+	}()
+	_, err = GenerateProofContext(context.Background(), dataDir, nil, nil, 1, 1, 1, 1, [32]byte{}, 0)
+	require.ErrorContains(t, err, "fail")
+}
@@ -0,0 +1,238 @@
+package postrs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// Sentinels for the reasons a proof fails verification. Every typed verification error matches one of them
+// with errors.Is.
+//
+// ErrProofRejected and ErrLabelRejected don't name a reason: libpost rejected the proof or the label of an index
+// without reporting why, and the proof doesn't reveal it either.
+var (
+	ErrProofRejected          = errors.New("proof rejected by libpost")
+	ErrInvalidNumberOfIndices = errors.New("invalid number of indices")
+	ErrIndexOutOfRange        = errors.New("index out of range")
+	ErrLabelRejected          = errors.New("label rejected by libpost")
+	ErrInvalidMetadata        = errors.New("invalid metadata")
+)
+
+// ProofRejectedError is returned if libpost rejected a proof without naming an index. Its metadata and number of
+// indices are valid, the reason isn't reported by libpost. The PoW is a likely cause, but not the only one.
+type ProofRejectedError struct {
+	Nonce uint32
+	Pow   uint64
+}
+
+func (e ProofRejectedError) Error() string {
+	return fmt.Sprintf("%v: reason unknown (nonce %d, pow %d)", ErrProofRejected, e.Nonce, e.Pow)
+}
+
+func (e ProofRejectedError) Is(target error) bool {
+	return target == ErrProofRejected
+}
+
+// InvalidNumberOfIndicesError is returned if the size of the indices of a proof doesn't match K2.
+type InvalidNumberOfIndicesError struct {
+	// Expected is K2.
+	Expected uint
+	// ExpectedSize is the size of K2 indices in bytes.
+	ExpectedSize int
+	// Size is the size of the indices in the proof in bytes.
+	Size int
+}
+
+func (e InvalidNumberOfIndicesError) Error() string {
+	return fmt.Sprintf("%v; expected: %d (%d bytes), given: %d bytes",
+		ErrInvalidNumberOfIndices, e.Expected, e.ExpectedSize, e.Size,
+	)
+}
+
+func (e InvalidNumberOfIndicesError) Is(target error) bool {
+	return target == ErrInvalidNumberOfIndices
+}
+
+// IndexOutOfRangeError is returned if an index of a proof is not below the number of labels.
+type IndexOutOfRangeError struct {
+	// Ordinal is the position of the index in the proof.
+	Ordinal   int
+	Index     uint64
+	NumLabels uint64
+}
+
+func (e IndexOutOfRangeError) Error() string {
+	return fmt.Sprintf("%v: index %d is %d, expected: < %d", ErrIndexOutOfRange, e.Ordinal, e.Index, e.NumLabels)
+}
+
+func (e IndexOutOfRangeError) Is(target error) bool {
+	return target == ErrIndexOutOfRange
+}
+
+// Unwrap returns the ErrInvalidIndex reported by libpost.
+func (e IndexOutOfRangeError) Unwrap() error {
+	return &ErrInvalidIndex{Index: e.Ordinal}
+}
+
+// LabelRejectedError is returned if libpost rejected an index of a proof that is in range. libpost doesn't report
+// why, usually the label at the index doesn't satisfy the K1 threshold.
+type LabelRejectedError struct {
+	// Ordinal is the position of the index in the proof.
+	Ordinal int
+	Index   uint64
+}
+
+func (e LabelRejectedError) Error() string {
+	return fmt.Sprintf("%v: label of index %d (%d), reason unknown", ErrLabelRejected, e.Ordinal, e.Index)
+}
+
+func (e LabelRejectedError) Is(target error) bool {
+	return target == ErrLabelRejected
+}
+
+// Unwrap returns the ErrInvalidIndex reported by libpost.
+func (e LabelRejectedError) Unwrap() error {
+	return &ErrInvalidIndex{Index: e.Ordinal}
+}
+
+// InvalidMetadataError is returned if a field of the proof metadata is invalid.
+type InvalidMetadataError struct {
+	Field    string
+	Expected string
+	Given    string
+}
+
+func (e InvalidMetadataError) Error() string {
+	return fmt.Sprintf("%v: invalid `%s`; expected: %s, given: %s", ErrInvalidMetadata, e.Field, e.Expected, e.Given)
+}
+
+func (e InvalidMetadataError) Is(target error) bool {
+	return target == ErrInvalidMetadata
+}
+
+// InvalidArgumentError is returned as the reason of ErrInvalidArgument if an argument of a verification other than
+// the proof and its metadata is invalid, e.g. the index selected with VerifyOne.
+type InvalidArgumentError struct {
+	Argument string
+	Expected string
+	Given    string
+}
+
+func (e InvalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid `%s`; expected: %s, given: %s", e.Argument, e.Expected, e.Given)
+}
+
+// checkMetadataIDs returns an InvalidMetadataError if an id in `metadata` doesn't have 32 bytes.
+func checkMetadataIDs(metadata *shared.ProofMetadata) error {
+	for _, field := range []struct {
+		name  string
+		value []byte
+	}{
+		{"NodeId", metadata.NodeId},
+		{"CommitmentAtxId", metadata.CommitmentAtxId},
+		{"Challenge", metadata.Challenge},
+	} {
+		if len(field.value) != 32 {
+			return InvalidMetadataError{
+				Field:    field.name,
+				Expected: "32 bytes",
+				Given:    fmt.Sprintf("%d bytes", len(field.value)),
+			}
+		}
+	}
+	return nil
+}
+
+// checkMetadata returns an InvalidMetadataError for the first field of `metadata` that libpost rejects.
+func checkMetadata(metadata *shared.ProofMetadata, cfg Config) error {
+	if err := checkMetadataIDs(metadata); err != nil {
+		return err
+	}
+	if metadata.NumUnits < cfg.MinNumUnits || metadata.NumUnits > cfg.MaxNumUnits {
+		return InvalidMetadataError{
+			Field:    "NumUnits",
+			Expected: fmt.Sprintf(">= %d and <= %d", cfg.MinNumUnits, cfg.MaxNumUnits),
+			Given:    fmt.Sprintf("%d", metadata.NumUnits),
+		}
+	}
+	return nil
+}
+
+// checkIndicesSize returns an InvalidNumberOfIndicesError if the indices of `proof` don't have the size of K2
+// indices.
+func checkIndicesSize(proof *shared.Proof, metadata *shared.ProofMetadata, cfg Config) error {
+	numLabels := uint64(metadata.NumUnits) * cfg.LabelsPerUnit
+	expected := shared.ProofIndicesSize(numLabels, cfg.K2)
+	if uint(len(proof.Indices)) != expected {
+		return InvalidNumberOfIndicesError{
+			Expected:     cfg.K2,
+			ExpectedSize: int(expected),
+			Size:         len(proof.Indices),
+		}
+	}
+	return nil
+}
+
+// invalidProofError explains why libpost rejected `proof` without naming an index. The C API doesn't report the
+// reason, so the metadata and number of indices are checked. If both are valid the reason is unknown.
+func invalidProofError(proof *shared.Proof, metadata *shared.ProofMetadata, cfg Config) error {
+	if err := checkMetadata(metadata, cfg); err != nil {
+		return err
+	}
+	if err := checkIndicesSize(proof, metadata, cfg); err != nil {
+		return err
+	}
+	return ProofRejectedError{Nonce: proof.Nonce, Pow: proof.Pow}
+}
+
+// invalidIndexError explains why libpost rejected the index at `ordinal` of `proof`.
+func invalidIndexError(proof *shared.Proof, metadata *shared.ProofMetadata, cfg Config, ordinal int) error {
+	numLabels := uint64(metadata.NumUnits) * cfg.LabelsPerUnit
+	indices, err := shared.DecodeIndices(proof.Indices, numLabels, cfg.K2)
+	if err != nil || ordinal >= len(indices) {
+		return &ErrInvalidIndex{Index: ordinal}
+	}
+	if indices[ordinal] >= numLabels {
+		return IndexOutOfRangeError{Ordinal: ordinal, Index: indices[ordinal], NumLabels: numLabels}
+	}
+	return LabelRejectedError{Ordinal: ordinal, Index: indices[ordinal]}
+}
+
+// invalidArgumentError explains why libpost rejected an argument of a verification. Like with invalidProofError
+// the C API doesn't report which one, so the arguments are checked. The returned error matches
+// ErrInvalidArgument and wraps an InvalidMetadataError, InvalidNumberOfIndicesError or InvalidArgumentError
+// naming the invalid argument, if one is found.
+func invalidArgumentError(
+	proof *shared.Proof,
+	metadata *shared.ProofMetadata,
+	cfg Config,
+	options verifyOptions,
+) error {
+	if err := checkMetadata(metadata, cfg); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	if err := checkIndicesSize(proof, metadata, cfg); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	switch mode := options.mode.(type) {
+	case verifyOneT:
+		if mode.ord < 0 || uint(mode.ord) >= cfg.K2 {
+			return fmt.Errorf("%w: %w", ErrInvalidArgument, InvalidArgumentError{
+				Argument: "index",
+				Expected: fmt.Sprintf(">= 0 and < %d", cfg.K2),
+				Given:    fmt.Sprintf("%d", mode.ord),
+			})
+		}
+	case verifySubsetT:
+		if mode.k3 == 0 || mode.k3 > cfg.K2 {
+			return fmt.Errorf("%w: %w", ErrInvalidArgument, InvalidArgumentError{
+				Argument: "k3",
+				Expected: fmt.Sprintf("> 0 and <= %d", cfg.K2),
+				Given:    fmt.Sprintf("%d", mode.k3),
+			})
+		}
+	}
+	return fmt.Errorf("%w: rejected by libpost, reason unknown", ErrInvalidArgument)
+}
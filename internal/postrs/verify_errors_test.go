@@ -0,0 +1,139 @@
+package postrs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestVerificationErrors(t *testing.T) {
+	cfg := Config{
+		MinNumUnits:   1,
+		MaxNumUnits:   4,
+		LabelsPerUnit: 100,
+		K1:            10,
+		K2:            3,
+	}
+	metadata := &shared.ProofMetadata{
+		NodeId:          make([]byte, 32),
+		CommitmentAtxId: make([]byte, 32),
+		Challenge:       make([]byte, 32),
+		NumUnits:        2,
+	}
+	// 200 labels need 8 bits per index, 255 is out of range
+	proof := &shared.Proof{Nonce: 5, Pow: 7, Indices: []byte{10, 255, 199}}
+
+	t.Run("rejected proof", func(t *testing.T) {
+		err := invalidProofError(proof, metadata, cfg)
+		require.ErrorIs(t, err, ErrProofRejected)
+		require.Equal(t, ProofRejectedError{Nonce: 5, Pow: 7}, err)
+	})
+
+	t.Run("invalid number of indices", func(t *testing.T) {
+		err := invalidProofError(&shared.Proof{Indices: []byte{1, 2}}, metadata, cfg)
+		require.ErrorIs(t, err, ErrInvalidNumberOfIndices)
+		var errIndices InvalidNumberOfIndicesError
+		require.ErrorAs(t, err, &errIndices)
+		require.Equal(t, InvalidNumberOfIndicesError{Expected: 3, ExpectedSize: 3, Size: 2}, errIndices)
+	})
+
+	t.Run("invalid metadata", func(t *testing.T) {
+		m := *metadata
+		m.NumUnits = 5
+		err := invalidProofError(proof, &m, cfg)
+		require.ErrorIs(t, err, ErrInvalidMetadata)
+		var errMetadata InvalidMetadataError
+		require.ErrorAs(t, err, &errMetadata)
+		require.Equal(t, "NumUnits", errMetadata.Field)
+		require.Equal(t, "5", errMetadata.Given)
+
+		m = *metadata
+		m.Challenge = m.Challenge[:31]
+		require.ErrorAs(t, checkMetadataIDs(&m), &errMetadata)
+		require.Equal(t, "Challenge", errMetadata.Field)
+		require.Equal(t, "31 bytes", errMetadata.Given)
+	})
+
+	t.Run("index out of range", func(t *testing.T) {
+		err := invalidIndexError(proof, metadata, cfg, 1)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+		require.NotErrorIs(t, err, ErrLabelRejected)
+		require.Equal(t, IndexOutOfRangeError{Ordinal: 1, Index: 255, NumLabels: 200}, err)
+
+		var errInvalidIndex *ErrInvalidIndex
+		require.ErrorAs(t, err, &errInvalidIndex)
+		require.Equal(t, 1, errInvalidIndex.Index)
+	})
+
+	t.Run("rejected label", func(t *testing.T) {
+		err := invalidIndexError(proof, metadata, cfg, 2)
+		require.ErrorIs(t, err, ErrLabelRejected)
+		require.Equal(t, LabelRejectedError{Ordinal: 2, Index: 199}, err)
+
+		var errInvalidIndex *ErrInvalidIndex
+		require.ErrorAs(t, err, &errInvalidIndex)
+		require.Equal(t, 2, errInvalidIndex.Index)
+	})
+
+	t.Run("invalid argument", func(t *testing.T) {
+		m := *metadata
+		m.NumUnits = 0
+		err := invalidArgumentError(proof, &m, cfg, verifyOptions{mode: verifyAllT{}})
+		require.ErrorIs(t, err, ErrInvalidArgument)
+		var errMetadata InvalidMetadataError
+		require.ErrorAs(t, err, &errMetadata)
+		require.Equal(t, InvalidMetadataError{Field: "NumUnits", Expected: ">= 1 and <= 4", Given: "0"}, errMetadata)
+
+		err = invalidArgumentError(&shared.Proof{Indices: []byte{1}}, metadata, cfg, verifyOptions{mode: verifyAllT{}})
+		require.ErrorIs(t, err, ErrInvalidArgument)
+		var errIndices InvalidNumberOfIndicesError
+		require.ErrorAs(t, err, &errIndices)
+		require.Equal(t, InvalidNumberOfIndicesError{Expected: 3, ExpectedSize: 3, Size: 1}, errIndices)
+
+		err = invalidArgumentError(proof, metadata, cfg, verifyOptions{mode: verifyOneT{ord: 3}})
+		require.ErrorIs(t, err, ErrInvalidArgument)
+		var errArgument InvalidArgumentError
+		require.ErrorAs(t, err, &errArgument)
+		require.Equal(t, InvalidArgumentError{Argument: "index", Expected: ">= 0 and < 3", Given: "3"}, errArgument)
+
+		err = invalidArgumentError(proof, metadata, cfg, verifyOptions{mode: verifySubsetT{k3: 4}})
+		require.ErrorAs(t, err, &errArgument)
+		require.Equal(t, InvalidArgumentError{Argument: "k3", Expected: "> 0 and <= 3", Given: "4"}, errArgument)
+
+		// the reason isn't found if all arguments are valid
+		err = invalidArgumentError(proof, metadata, cfg, verifyOptions{mode: verifyOneT{ord: 2}})
+		require.ErrorIs(t, err, ErrInvalidArgument)
+		require.False(t, errors.As(err, &errArgument))
+		require.ErrorContains(t, err, "reason unknown")
+	})
+
+	t.Run("undecodable indices", func(t *testing.T) {
+		err := invalidIndexError(&shared.Proof{Indices: []byte{1}}, metadata, cfg, 0)
+		require.Equal(t, &ErrInvalidIndex{Index: 0}, err)
+	})
+}
+
+func TestVerifyProof_InvalidArguments(t *testing.T) {
+	verifier, err := NewVerifier(GetRecommendedPowFlags())
+	require.NoError(t, err)
+	defer verifier.Close()
+
+	cfg := Config{MinNumUnits: 1, MaxNumUnits: 4, LabelsPerUnit: 100, K1: 10, K2: 3}
+	metadata := &shared.ProofMetadata{
+		NodeId:          make([]byte, 31),
+		CommitmentAtxId: make([]byte, 32),
+		Challenge:       make([]byte, 32),
+		NumUnits:        2,
+	}
+	err = verifier.VerifyProof(&shared.Proof{Indices: []byte{1, 2, 3}}, metadata, nil, cfg, NewScryptParams(2, 1, 1))
+	var errMetadata InvalidMetadataError
+	require.ErrorAs(t, err, &errMetadata)
+	require.Equal(t, "NodeId", errMetadata.Field)
+
+	metadata.NodeId = make([]byte, 32)
+	err = verifier.VerifyProof(&shared.Proof{}, metadata, nil, cfg, NewScryptParams(2, 1, 1))
+	require.ErrorIs(t, err, ErrInvalidNumberOfIndices)
+}
@@ -1,6 +1,8 @@
 package oracle
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -15,6 +17,16 @@ import (
 // ErrWorkOracleClosed is returned when calling a method on an already closed WorkOracle instance.
 var ErrWorkOracleClosed = errors.New("work oracle has been closed")
 
+const (
+	// DefaultCPUChunkSize is the default number of labels computed per call to the CPU provider
+	// by PositionsContext.
+	DefaultCPUChunkSize = 1 << 14
+
+	// DefaultGPUChunkSize is the default number of labels computed per call to an OpenCL provider
+	// by PositionsContext.
+	DefaultGPUChunkSize = 1 << 20
+)
+
 type option struct {
 	providerID *uint32
 
@@ -26,6 +38,7 @@ type option struct {
 
 	maxRetries int
 	retryDelay time.Duration
+	chunkSize  uint64
 
 	scrypter postrs.Scrypter
 }
@@ -120,6 +133,20 @@ func WithMaxRetries(maxRetries int) OptionFunc {
 	}
 }
 
+// WithChunkSize sets the maximum number of labels computed in a single call to the provider
+// by PositionsContext. Between chunks the context is checked for cancellation.
+// If not set, DefaultCPUChunkSize or DefaultGPUChunkSize is used depending on the provider.
+func WithChunkSize(chunkSize uint64) OptionFunc {
+	return func(opts *option) error {
+		if chunkSize == 0 {
+			return errors.New("invalid `chunkSize`; expected: > 0, given: 0")
+		}
+
+		opts.chunkSize = chunkSize
+		return nil
+	}
+}
+
 func withScrypter(scrypter postrs.Scrypter) OptionFunc {
 	return func(opts *option) error {
 		opts.scrypter = scrypter
@@ -151,6 +178,16 @@ func (l *LazyScrypter) Positions(start, end uint64) (postrs.ScryptPositionsResul
 	return l.scrypt.Positions(start, end)
 }
 
+func (l *LazyScrypter) PositionsInto(dst []byte, start, end uint64) (postrs.ScryptPositionsResult, error) {
+	l.initOnce.Do(func() {
+		l.scrypt, l.err = l.init()
+	})
+	if l.err != nil {
+		return postrs.ScryptPositionsResult{}, fmt.Errorf("initializing scrypter: %w", l.err)
+	}
+	return l.scrypt.PositionsInto(dst, start, end)
+}
+
 func (l *LazyScrypter) Close() error {
 	if l.scrypt != nil {
 		return l.scrypt.Close()
@@ -176,6 +213,13 @@ func New(opts ...OptionFunc) (*WorkOracle, error) {
 		return nil, err
 	}
 
+	if options.chunkSize == 0 {
+		options.chunkSize = DefaultCPUChunkSize
+		if options.providerID != nil && *options.providerID != postrs.CPUProviderID() {
+			options.chunkSize = DefaultGPUChunkSize
+		}
+	}
+
 	scrypt := options.scrypter
 	if scrypt == nil {
 		scrypt = &LazyScrypter{init: func() (postrs.Scrypter, error) {
@@ -234,9 +278,117 @@ func (w *WorkOracle) Positions(start, end uint64) (WorkOracleResult, error) {
 			fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
 	}
 
+	return w.withRetries(context.Background(), func() (postrs.ScryptPositionsResult, error) {
+		return w.scrypt.Positions(start, end)
+	})
+}
+
+// PositionsInto computes the labels for a given range of positions and writes them into dst.
+// dst must be large enough to hold postrs.LabelLength * (end - start + 1) bytes.
+//
+// Unlike Positions it doesn't allocate a new buffer for every call, which allows callers
+// computing many batches to reuse their buffers. The Output of the returned result is a
+// sub-slice of dst.
+func (w *WorkOracle) PositionsInto(dst []byte, start, end uint64) (WorkOracleResult, error) {
+	if w.scrypt == nil {
+		return WorkOracleResult{}, ErrWorkOracleClosed
+	}
+
+	if start > end {
+		return WorkOracleResult{},
+			fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
+	}
+
+	if size := postrs.LabelLength * (end - start + 1); uint64(len(dst)) < size {
+		return WorkOracleResult{}, fmt.Errorf("invalid `dst` length; expected: >= %v, given: %v", size, len(dst))
+	}
+
+	return w.withRetries(context.Background(), func() (postrs.ScryptPositionsResult, error) {
+		return w.scrypt.PositionsInto(dst, start, end)
+	})
+}
+
+// PositionsContext computes the labels for a given range of positions.
+//
+// The range is split into chunks (see WithChunkSize) and the context is checked before
+// every chunk and while waiting to retry a failed chunk. If the context is canceled the
+// labels computed so far are returned together with the context's error: the Output then
+// contains the labels of the positions `start` to `start + len(Output)/postrs.LabelLength - 1`.
+func (w *WorkOracle) PositionsContext(ctx context.Context, start, end uint64) (WorkOracleResult, error) {
+	if start > end {
+		return WorkOracleResult{},
+			fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
+	}
+
+	return w.PositionsIntoContext(ctx, make([]byte, postrs.LabelLength*(end-start+1)), start, end)
+}
+
+// PositionsIntoContext is like PositionsContext but writes the labels into dst.
+// dst must be large enough to hold postrs.LabelLength * (end - start + 1) bytes.
+func (w *WorkOracle) PositionsIntoContext(
+	ctx context.Context,
+	dst []byte,
+	start, end uint64,
+) (WorkOracleResult, error) {
+	if w.scrypt == nil {
+		return WorkOracleResult{}, ErrWorkOracleClosed
+	}
+
+	if start > end {
+		return WorkOracleResult{},
+			fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
+	}
+
+	if size := postrs.LabelLength * (end - start + 1); uint64(len(dst)) < size {
+		return WorkOracleResult{}, fmt.Errorf("invalid `dst` length; expected: >= %v, given: %v", size, len(dst))
+	}
+
+	result := WorkOracleResult{Output: dst[:0]}
+	for chunkStart := start; ; chunkStart += w.options.chunkSize {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		chunkEnd := end
+		if end-chunkStart >= w.options.chunkSize {
+			chunkEnd = chunkStart + w.options.chunkSize - 1
+		}
+
+		offset := (chunkStart - start) * postrs.LabelLength
+		res, err := w.withRetries(ctx, func() (postrs.ScryptPositionsResult, error) {
+			return w.scrypt.PositionsInto(dst[offset:], chunkStart, chunkEnd)
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.Output = dst[:offset+uint64(len(res.Output))]
+		if res.Nonce != nil && (result.Nonce == nil || bytes.Compare(
+			labelAt(dst, start, *res.Nonce),
+			labelAt(dst, start, *result.Nonce),
+		) < 0) {
+			result.Nonce = res.Nonce
+		}
+
+		if chunkEnd == end {
+			return result, nil
+		}
+	}
+}
+
+// labelAt returns the label for `position` in `labels` which start at position `start`.
+func labelAt(labels []byte, start, position uint64) []byte {
+	offset := (position - start) * postrs.LabelLength
+	return labels[offset : offset+postrs.LabelLength]
+}
+
+func (w *WorkOracle) withRetries(
+	ctx context.Context,
+	positions func() (postrs.ScryptPositionsResult, error),
+) (WorkOracleResult, error) {
 	tries := 0
 	for {
-		res, err := w.scrypt.Positions(start, end)
+		res, err := positions()
 		tries += 1
 		switch {
 		case errors.Is(err, postrs.ErrInitializationFailed):
@@ -245,7 +397,13 @@ func (w *WorkOracle) Positions(start, end uint64) (WorkOracleResult, error) {
 				return WorkOracleResult{}, fmt.Errorf("failed to initialize scrypt after %v tries", tries)
 			}
 			w.options.logger.With().Warn("retrying initialization", zap.Int("tries", tries))
-			time.Sleep(w.options.retryDelay)
+			timer := time.NewTimer(w.options.retryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return WorkOracleResult{}, ctx.Err()
+			case <-timer.C:
+			}
 		case err != nil:
 			return WorkOracleResult{}, err
 		default:
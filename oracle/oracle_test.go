@@ -1,8 +1,10 @@
 package oracle
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -96,3 +98,167 @@ func TestOracleCantInitializeAfterClose(t *testing.T) {
 	_, err = o.Positions(0, 10)
 	require.Error(t, err)
 }
+
+func TestOracleRetryPositionsInto(t *testing.T) {
+	commitment := make([]byte, 32)
+	vrfDifficulty := make([]byte, 32)
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		WithMaxRetries(2),
+		WithRetryDelay(0),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	dst := make([]byte, 11*postrs.LabelLength)
+	t.Run("retries max time and quits", func(t *testing.T) {
+		mockScrypter.EXPECT().PositionsInto(dst, uint64(0), uint64(10)).
+			Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(3)
+		_, err := o.PositionsInto(dst, 0, 10)
+		require.Error(t, err)
+	})
+	t.Run("eventually succeeds", func(t *testing.T) {
+		mockScrypter.EXPECT().PositionsInto(dst, uint64(0), uint64(10)).
+			Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(2)
+		mockScrypter.EXPECT().PositionsInto(dst, uint64(0), uint64(10)).
+			Return(postrs.ScryptPositionsResult{Output: dst}, nil).Times(1)
+		res, err := o.PositionsInto(dst, 0, 10)
+		require.NoError(t, err)
+		require.Equal(t, dst, res.Output)
+	})
+}
+
+func TestOracleFailsOnTooSmallBuffer(t *testing.T) {
+	commitment := make([]byte, 32)
+	vrfDifficulty := make([]byte, 32)
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	_, err = o.PositionsInto(make([]byte, 10*postrs.LabelLength), 0, 10)
+	require.ErrorContains(t, err, "invalid `dst` length")
+}
+
+// fillPositions returns a function for mocking Scrypter.PositionsInto that fills every label
+// with the lowest byte of its position.
+func fillPositions(nonce *uint64) func([]byte, uint64, uint64) (postrs.ScryptPositionsResult, error) {
+	return func(dst []byte, start, end uint64) (postrs.ScryptPositionsResult, error) {
+		output := dst[:(end-start+1)*postrs.LabelLength]
+		for i := range output {
+			output[i] = byte(start + uint64(i)/postrs.LabelLength)
+		}
+		return postrs.ScryptPositionsResult{Output: output, IdxSolution: nonce}, nil
+	}
+}
+
+func TestOraclePositionsContext_Chunks(t *testing.T) {
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(
+		WithCommitment(make([]byte, 32)),
+		WithVRFDifficulty(make([]byte, 32)),
+		WithChunkSize(4),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	gomock.InOrder(
+		mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(10), uint64(13)).DoAndReturn(fillPositions(nil)),
+		mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(14), uint64(17)).DoAndReturn(fillPositions(nil)),
+		mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(18), uint64(19)).DoAndReturn(fillPositions(nil)),
+	)
+
+	res, err := o.PositionsContext(context.Background(), 10, 19)
+	require.NoError(t, err)
+	require.Len(t, res.Output, 10*postrs.LabelLength)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, byte(10+i), res.Output[i*postrs.LabelLength])
+	}
+	require.Nil(t, res.Nonce)
+}
+
+func TestOraclePositionsContext_BestNonce(t *testing.T) {
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(
+		WithCommitment(make([]byte, 32)),
+		WithVRFDifficulty(make([]byte, 32)),
+		WithChunkSize(4),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	higher := uint64(5)
+	lower := uint64(2)
+	gomock.InOrder(
+		mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(0), uint64(3)).DoAndReturn(fillPositions(&lower)),
+		mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(4), uint64(7)).DoAndReturn(fillPositions(&higher)),
+	)
+
+	res, err := o.PositionsContext(context.Background(), 0, 7)
+	require.NoError(t, err)
+	require.NotNil(t, res.Nonce)
+	require.Equal(t, lower, *res.Nonce)
+}
+
+func TestOraclePositionsContext_Canceled(t *testing.T) {
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(
+		WithCommitment(make([]byte, 32)),
+		WithVRFDifficulty(make([]byte, 32)),
+		WithChunkSize(4),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nonce := uint64(1)
+	mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(0), uint64(3)).DoAndReturn(
+		func(dst []byte, start, end uint64) (postrs.ScryptPositionsResult, error) {
+			cancel()
+			return fillPositions(&nonce)(dst, start, end)
+		},
+	)
+
+	res, err := o.PositionsContext(ctx, 0, 15)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, res.Output, 4*postrs.LabelLength)
+	require.NotNil(t, res.Nonce)
+	require.Equal(t, nonce, *res.Nonce)
+}
+
+func TestOraclePositionsContext_CancelRetry(t *testing.T) {
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(
+		WithCommitment(make([]byte, 32)),
+		WithVRFDifficulty(make([]byte, 32)),
+		WithMaxRetries(10),
+		WithRetryDelay(time.Hour),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	mockScrypter.EXPECT().PositionsInto(gomock.Any(), uint64(0), uint64(10)).
+		Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(1)
+
+	_, err = o.PositionsContext(ctx, 0, 10)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestOracleInvalidChunkSize(t *testing.T) {
+	_, err := New(
+		WithCommitment(make([]byte, 32)),
+		WithVRFDifficulty(make([]byte, 32)),
+		WithChunkSize(0),
+	)
+	require.ErrorContains(t, err, "invalid `chunkSize`")
+}
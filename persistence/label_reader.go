@@ -0,0 +1,98 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// ErrLabelMissing is returned by LabelReader if a label isn't stored in the data directory.
+var ErrLabelMissing = errors.New("label is missing")
+
+// LabelReader reads single labels at random positions from the initialization files of a data directory.
+// It is safe for concurrent use.
+type LabelReader struct {
+	datadir       string
+	labelsPerFile uint64
+	bytesPerLabel uint64
+
+	mtx   sync.Mutex
+	files map[int]*os.File
+}
+
+// NewLabelReader returns a LabelReader for `datadir`, where every initialization file except the last one holds
+// `labelsPerFile` labels.
+func NewLabelReader(datadir string, labelsPerFile uint64, bitsPerLabel uint) (*LabelReader, error) {
+	if labelsPerFile == 0 {
+		return nil, errors.New("invalid `labelsPerFile`; expected: > 0, given: 0")
+	}
+	if bitsPerLabel == 0 || bitsPerLabel%8 != 0 {
+		return nil, fmt.Errorf("invalid `bitsPerLabel`; expected: a multiple of 8, given: %d", bitsPerLabel)
+	}
+	return &LabelReader{
+		datadir:       datadir,
+		labelsPerFile: labelsPerFile,
+		bytesPerLabel: uint64(bitsPerLabel / 8),
+		files:         make(map[int]*os.File),
+	}, nil
+}
+
+// Position returns the index of the file that stores the label at `index` and its offset in bytes in that file.
+func (r *LabelReader) Position(index uint64) (fileIndex int, offset uint64) {
+	return int(index / r.labelsPerFile), index % r.labelsPerFile * r.bytesPerLabel
+}
+
+// ReadLabel reads the label at `index`. If the file of the label is missing or too short the returned error
+// wraps ErrLabelMissing.
+func (r *LabelReader) ReadLabel(index uint64) ([]byte, error) {
+	fileIndex, offset := r.Position(index)
+	f, err := r.file(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	label := make([]byte, r.bytesPerLabel)
+	if _, err := f.ReadAt(label, int64(offset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: offset %d is beyond the end of %s", ErrLabelMissing, offset, f.Name())
+		}
+		return nil, err
+	}
+	return label, nil
+}
+
+func (r *LabelReader) file(fileIndex int) (*os.File, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if f, ok := r.files[fileIndex]; ok {
+		return f, nil
+	}
+
+	f, err := os.Open(filepath.Join(r.datadir, shared.InitFileName(fileIndex)))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("%w: file %s is missing", ErrLabelMissing, shared.InitFileName(fileIndex))
+	case err != nil:
+		return nil, err
+	}
+	r.files[fileIndex] = f
+	return f, nil
+}
+
+// Close closes the opened files.
+func (r *LabelReader) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var errs []error
+	for _, f := range r.files {
+		errs = append(errs, f.Close())
+	}
+	r.files = make(map[int]*os.File)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestLabelReader(t *testing.T) {
+	datadir := t.TempDir()
+	labelSize := uint(16)
+	labels := genLabels(10, labelSize*8)
+
+	// 4 labels per file, the last file holds only 2 labels
+	for i := 0; i < 3; i++ {
+		var data []byte
+		for _, label := range labels[i*4 : min(i*4+4, len(labels))] {
+			data = append(data, label...)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(datadir, shared.InitFileName(i)), data, 0o600))
+	}
+
+	r, err := NewLabelReader(datadir, 4, labelSize*8)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for i := len(labels) - 1; i >= 0; i-- {
+		label, err := r.ReadLabel(uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, labels[i], label)
+	}
+
+	fileIndex, offset := r.Position(9)
+	require.Equal(t, 2, fileIndex)
+	require.EqualValues(t, 16, offset)
+
+	_, err = r.ReadLabel(10)
+	require.ErrorIs(t, err, ErrLabelMissing)
+	require.ErrorContains(t, err, "beyond the end")
+	_, err = r.ReadLabel(12)
+	require.ErrorIs(t, err, ErrLabelMissing)
+	require.ErrorContains(t, err, "postdata_3.bin is missing")
+}
+
+func TestNewLabelReader_Invalid(t *testing.T) {
+	_, err := NewLabelReader(t.TempDir(), 0, 128)
+	require.ErrorContains(t, err, "invalid `labelsPerFile`")
+	_, err = NewLabelReader(t.TempDir(), 1, 7)
+	require.ErrorContains(t, err, "invalid `bitsPerLabel`")
+}
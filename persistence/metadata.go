@@ -0,0 +1,101 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/natefinch/atomic"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// MetadataFileName is the name of the file that holds the metadata of the PoST data in a data directory.
+const MetadataFileName = "postdata_metadata.json"
+
+// ErrMetadataFileMissing is returned by LoadMetadata if the data directory has no metadata file.
+var ErrMetadataFileMissing = errors.New("metadata file is missing")
+
+// SaveMetadata writes `v` to the metadata file in `dir`, creating `dir` if it doesn't exist.
+func SaveMetadata(dir string, v *shared.PostMetadata) error {
+	err := os.MkdirAll(dir, shared.OwnerReadWriteExec)
+	switch {
+	case errors.Is(err, fs.ErrExist):
+	case err != nil:
+		return fmt.Errorf("dir creation failure: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	if err := atomic.WriteFile(filepath.Join(dir, MetadataFileName), bytes.NewBuffer(data)); err != nil {
+		return fmt.Errorf("write to disk failure: %w", err)
+	}
+
+	return nil
+}
+
+// LoadMetadata reads the metadata file in `dir`. It returns ErrMetadataFileMissing if the file doesn't exist.
+func LoadMetadata(dir string) (*shared.PostMetadata, error) {
+	filename := filepath.Join(dir, MetadataFileName)
+	data, err := os.ReadFile(filename)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, ErrMetadataFileMissing
+	case err != nil:
+		return nil, fmt.Errorf("read file failure: %w", err)
+	}
+
+	metadata := shared.PostMetadata{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// VerifyMetadata returns a shared.ConfigMismatchError if the PoST data in `datadir` described by `m` doesn't belong
+// to `nodeId` and `commitmentAtxId` or wasn't initialized with `labelsPerUnit`.
+func VerifyMetadata(
+	m *shared.PostMetadata,
+	datadir string,
+	nodeId, commitmentAtxId []byte,
+	labelsPerUnit uint64,
+) error {
+	if !bytes.Equal(nodeId, m.NodeId) {
+		return shared.ConfigMismatchError{
+			Param:    "NodeId",
+			Expected: hex.EncodeToString(nodeId),
+			Found:    hex.EncodeToString(m.NodeId),
+			DataDir:  datadir,
+		}
+	}
+
+	if !bytes.Equal(commitmentAtxId, m.CommitmentAtxId) {
+		return shared.ConfigMismatchError{
+			Param:    "CommitmentAtxId",
+			Expected: hex.EncodeToString(commitmentAtxId),
+			Found:    hex.EncodeToString(m.CommitmentAtxId),
+			DataDir:  datadir,
+		}
+	}
+
+	if labelsPerUnit != m.LabelsPerUnit {
+		return shared.ConfigMismatchError{
+			Param:    "LabelsPerUnit",
+			Expected: strconv.FormatUint(labelsPerUnit, 10),
+			Found:    strconv.FormatUint(m.LabelsPerUnit, 10),
+			DataDir:  datadir,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestMetadata(t *testing.T) {
+	datadir := t.TempDir()
+	_, err := LoadMetadata(datadir)
+	require.ErrorIs(t, err, ErrMetadataFileMissing)
+
+	m := &shared.PostMetadata{
+		NodeId:          make([]byte, 32),
+		CommitmentAtxId: make([]byte, 32),
+		LabelsPerUnit:   256,
+		NumUnits:        2,
+		MaxFileSize:     4096,
+	}
+	require.NoError(t, SaveMetadata(datadir, m))
+	loaded, err := LoadMetadata(datadir)
+	require.NoError(t, err)
+	require.Equal(t, m, loaded)
+
+	require.NoError(t, VerifyMetadata(loaded, datadir, m.NodeId, m.CommitmentAtxId, m.LabelsPerUnit))
+
+	var errMismatch shared.ConfigMismatchError
+	nodeId := append([]byte{1}, m.NodeId[1:]...)
+	require.ErrorAs(t, VerifyMetadata(loaded, datadir, nodeId, m.CommitmentAtxId, m.LabelsPerUnit), &errMismatch)
+	require.Equal(t, "NodeId", errMismatch.Param)
+	require.ErrorAs(t, VerifyMetadata(loaded, datadir, m.NodeId, nodeId, m.LabelsPerUnit), &errMismatch)
+	require.Equal(t, "CommitmentAtxId", errMismatch.Param)
+	require.ErrorAs(t, VerifyMetadata(loaded, datadir, m.NodeId, m.CommitmentAtxId, 512), &errMismatch)
+	require.Equal(t, "LabelsPerUnit", errMismatch.Param)
+}
@@ -0,0 +1,89 @@
+package proving
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+// IndexReport describes the label a proof refers to with one of its indices.
+type IndexReport struct {
+	Index     uint64
+	FileIndex int
+	// Offset is the offset of the label in bytes within the file.
+	Offset   uint64
+	Stored   shared.HexBytes
+	Expected shared.HexBytes
+	// Match is true if the label stored on disk is the expected label.
+	Match bool
+	// Error explains why the stored label couldn't be read.
+	Error string `json:",omitempty"`
+}
+
+// File returns the name of the file that contains the label.
+func (r IndexReport) File() string {
+	return shared.InitFileName(r.FileIndex)
+}
+
+// ProofReport is the result of InspectProof.
+type ProofReport struct {
+	NumLabels     uint64
+	LabelsPerFile uint64
+	Indices       []IndexReport
+}
+
+// Mismatches returns the reports of all indices that don't refer to the expected label.
+func (r *ProofReport) Mismatches() []IndexReport {
+	var mismatches []IndexReport
+	for _, index := range r.Indices {
+		if !index.Match {
+			mismatches = append(mismatches, index)
+		}
+	}
+	return mismatches
+}
+
+// InspectProof maps the indices of a proof to the labels stored in `datadir` and compares them with the labels
+// recomputed with the CPU provider, see verifying.ReadStoredLabels. It helps to find out which file is corrupted if
+// a proof fails to verify.
+//
+// `scrypt` are the parameters the data in `datadir` was initialized with.
+func InspectProof(
+	ctx context.Context,
+	proof *shared.Proof,
+	metadata *shared.ProofMetadata,
+	cfg config.Config,
+	datadir string,
+	scrypt config.ScryptParams,
+	logger *zap.Logger,
+) (*ProofReport, error) {
+	labels, err := verifying.ReadStoredLabels(ctx, proof, metadata, cfg, datadir, scrypt, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ProofReport{
+		NumLabels:     labels.NumLabels,
+		LabelsPerFile: labels.LabelsPerFile,
+		Indices:       make([]IndexReport, 0, len(labels.Labels)),
+	}
+	for _, l := range labels.Labels {
+		r := IndexReport{
+			Index:     l.Index,
+			FileIndex: l.FileIndex,
+			Offset:    l.Offset,
+			Stored:    l.Stored,
+			Expected:  l.Expected,
+			Match:     l.Match(),
+		}
+		if l.Err != nil {
+			r.Error = l.Err.Error()
+		}
+		report.Indices = append(report.Indices, r)
+	}
+	return report, nil
+}
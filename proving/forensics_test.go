@@ -0,0 +1,126 @@
+package proving
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestInspectProof(t *testing.T) {
+	r := require.New(t)
+	log := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	cfg, opts := getTestConfig(t)
+	opts.NumUnits = 2
+	opts.MaxFileSize = 256 * uint64(config.BytesPerLabel()) // 4 files
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(log),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	numLabels := uint64(opts.NumUnits) * cfg.LabelsPerUnit
+	indices := make([]uint64, cfg.K2)
+	for i := range indices {
+		indices[i] = uint64(i) * 97 % numLabels
+	}
+	encoded, err := shared.EncodeIndices(indices, numLabels)
+	r.NoError(err)
+	proof := &shared.Proof{Indices: encoded}
+	metadata := &shared.ProofMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		Challenge:       shared.ZeroChallenge,
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+
+	report, err := InspectProof(context.Background(), proof, metadata, cfg, opts.DataDir, opts.Scrypt, log)
+	r.NoError(err)
+	r.Equal(numLabels, report.NumLabels)
+	r.Equal(uint64(256), report.LabelsPerFile)
+	r.Len(report.Indices, int(cfg.K2))
+	r.Empty(report.Mismatches())
+	for i, index := range report.Indices {
+		r.Equal(indices[i], index.Index)
+		r.Equal(int(indices[i]/256), index.FileIndex)
+		r.Equal(indices[i]%256*uint64(config.BytesPerLabel()), index.Offset)
+		r.Equal(index.Expected, index.Stored)
+	}
+
+	// corrupt the label of index 97 (file 0) and remove file 2
+	f, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), os.O_WRONLY, 0)
+	r.NoError(err)
+	_, err = f.WriteAt(make([]byte, config.BytesPerLabel()), 97*int64(config.BytesPerLabel()))
+	r.NoError(err)
+	r.NoError(f.Close())
+	r.NoError(os.Remove(filepath.Join(opts.DataDir, shared.InitFileName(2))))
+
+	report, err = InspectProof(context.Background(), proof, metadata, cfg, opts.DataDir, opts.Scrypt, log)
+	r.NoError(err)
+	for _, index := range report.Indices {
+		switch {
+		case index.Index == 97:
+			r.False(index.Match)
+			r.Empty(index.Error)
+			r.Equal(shared.HexBytes(make([]byte, config.BytesPerLabel())), index.Stored)
+			r.NotEqual(index.Expected, index.Stored)
+		case index.FileIndex == 2:
+			r.False(index.Match)
+			r.Contains(index.Error, "is missing")
+			r.Nil(index.Stored)
+			r.NotNil(index.Expected)
+		default:
+			r.True(index.Match, index.Index)
+		}
+	}
+	r.NotEmpty(report.Mismatches())
+}
+
+func TestInspectProof_InvalidProof(t *testing.T) {
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	cfg, opts := getTestConfig(t)
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(zaptest.NewLogger(t)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	metadata := &shared.ProofMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	proof := &shared.Proof{Indices: []byte{1, 2, 3}}
+	_, err = InspectProof(context.Background(), proof, metadata, cfg, opts.DataDir, opts.Scrypt, zaptest.NewLogger(t))
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+
+	metadata.NodeId = append([]byte{1}, nodeId[1:]...)
+	_, err = InspectProof(context.Background(), proof, metadata, cfg, opts.DataDir, opts.Scrypt, zaptest.NewLogger(t))
+	var errConfigMismatch shared.ConfigMismatchError
+	require.ErrorAs(t, err, &errConfigMismatch)
+	require.Equal(t, "NodeId", errConfigMismatch.Param)
+}
@@ -0,0 +1,343 @@
+package proving
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/shared"
+)
+
+// ProofGenerator generates proofs like Generate. It must not serialize the proofs it generates, otherwise the
+// concurrency limits of the Orchestrator have no effect.
+type ProofGenerator interface {
+	Generate(
+		ctx context.Context,
+		ch shared.Challenge,
+		cfg config.Config,
+		logger *zap.Logger,
+		opts ...OptionFunc,
+	) (*shared.Proof, *shared.ProofMetadata, error)
+}
+
+// GeneratorFunc is a function that implements ProofGenerator. GeneratorFunc(Generate) is the default prover of
+// the Orchestrator.
+type GeneratorFunc func(
+	ctx context.Context,
+	ch shared.Challenge,
+	cfg config.Config,
+	logger *zap.Logger,
+	opts ...OptionFunc,
+) (*shared.Proof, *shared.ProofMetadata, error)
+
+func (f GeneratorFunc) Generate(
+	ctx context.Context,
+	ch shared.Challenge,
+	cfg config.Config,
+	logger *zap.Logger,
+	opts ...OptionFunc,
+) (*shared.Proof, *shared.ProofMetadata, error) {
+	return f(ctx, ch, cfg, logger, opts...)
+}
+
+// DataSource describes the data of an identity the Orchestrator generates a proof for.
+type DataSource struct {
+	// Name identifies the data source in the outcomes of Run.
+	Name            string
+	NodeId          []byte
+	CommitmentAtxId []byte
+	Datadir         string
+	// Disk is the physical disk the data is stored on. Data sources on the same disk share its concurrency limit.
+	// Defaults to Datadir, i.e. every data source is on its own disk.
+	Disk string
+	// Priority orders the data sources on the same disk. Data sources with a higher priority are proven first.
+	Priority int
+}
+
+// Outcome is the result of generating a proof for a DataSource.
+type Outcome struct {
+	Name     string
+	Proof    *shared.Proof
+	Metadata *shared.ProofMetadata
+	Err      error
+	// Attempts is the number of times proving was started for the data source.
+	Attempts int
+	// Duration is the total time spent generating proofs for the data source, including failed attempts.
+	Duration time.Duration
+}
+
+type orchestratorOption struct {
+	prover          ProofGenerator
+	cfg             *config.Config
+	logger          *zap.Logger
+	diskConcurrency int
+	maxAttempts     int
+	retryDelay      time.Duration
+	provingOpts     []OptionFunc
+}
+
+func (o *orchestratorOption) validate() error {
+	if o.prover == nil {
+		return errors.New("no prover provided")
+	}
+	if o.cfg == nil {
+		return errors.New("no config provided")
+	}
+	if o.diskConcurrency < 1 {
+		return fmt.Errorf("invalid `diskConcurrency`; expected: >= 1, given: %d", o.diskConcurrency)
+	}
+	if o.maxAttempts < 1 {
+		return fmt.Errorf("invalid `maxAttempts`; expected: >= 1, given: %d", o.maxAttempts)
+	}
+	return nil
+}
+
+type OrchestratorOptionFunc func(*orchestratorOption) error
+
+// WithOrchestratorProver sets the prover used to generate the proofs. Defaults to GeneratorFunc(Generate).
+func WithOrchestratorProver(prover ProofGenerator) OrchestratorOptionFunc {
+	return func(o *orchestratorOption) error {
+		o.prover = prover
+		return nil
+	}
+}
+
+// WithOrchestratorConfig sets the config used to generate the proofs.
+func WithOrchestratorConfig(cfg config.Config) OrchestratorOptionFunc {
+	return func(o *orchestratorOption) error {
+		o.cfg = &cfg
+		return nil
+	}
+}
+
+// WithOrchestratorLogger sets the logger of the Orchestrator.
+func WithOrchestratorLogger(logger *zap.Logger) OrchestratorOptionFunc {
+	return func(o *orchestratorOption) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithOrchestratorDiskConcurrency sets how many proofs are generated at the same time for data sources on the
+// same disk. Defaults to 1.
+func WithOrchestratorDiskConcurrency(n int) OrchestratorOptionFunc {
+	return func(o *orchestratorOption) error {
+		o.diskConcurrency = n
+		return nil
+	}
+}
+
+// WithOrchestratorRetries sets how often proving is started for a data source before its failure is reported
+// and the delay between two attempts. Defaults to 3 attempts with a delay of 1 second.
+func WithOrchestratorRetries(maxAttempts int, delay time.Duration) OrchestratorOptionFunc {
+	return func(o *orchestratorOption) error {
+		o.maxAttempts = maxAttempts
+		o.retryDelay = delay
+		return nil
+	}
+}
+
+// WithOrchestratorProvingOptions sets additional options passed to every call to Generate, e.g. WithNonces.
+func WithOrchestratorProvingOptions(opts ...OptionFunc) OrchestratorOptionFunc {
+	return func(o *orchestratorOption) error {
+		o.provingOpts = opts
+		return nil
+	}
+}
+
+// Orchestrator generates proofs for the data of several identities before a deadline. It limits the number of
+// proofs generated at the same time per disk and retries failed attempts.
+type Orchestrator struct {
+	options *orchestratorOption
+}
+
+// NewOrchestrator creates a new Orchestrator.
+func NewOrchestrator(opts ...OrchestratorOptionFunc) (*Orchestrator, error) {
+	options := &orchestratorOption{
+		prover:          GeneratorFunc(Generate),
+		logger:          zap.NewNop(),
+		diskConcurrency: 1,
+		maxAttempts:     3,
+		retryDelay:      time.Second,
+	}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	return &Orchestrator{options: options}, nil
+}
+
+// diskQueue is the queue of data sources on a single disk.
+type diskQueue struct {
+	mtx     sync.Mutex
+	pending []int
+}
+
+func (q *diskQueue) next() (int, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.pending) == 0 {
+		return 0, false
+	}
+	i := q.pending[0]
+	q.pending = q.pending[1:]
+	return i, true
+}
+
+// retry queues a failed data source again. It is moved behind the data sources that haven't been tried yet.
+func (q *diskQueue) retry(i int) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.pending = append(q.pending, i)
+}
+
+// Run generates a proof for `ch` for every data source. Proving is stopped when `deadline` passes; a zero
+// deadline means no deadline. The outcome for sources[i] is returned at index i.
+//
+// The returned error is only set if the data sources are invalid, failures of single data sources are
+// reported in their Outcome.
+func (o *Orchestrator) Run(
+	ctx context.Context,
+	ch shared.Challenge,
+	deadline time.Time,
+	sources []DataSource,
+) ([]Outcome, error) {
+	queues := make(map[string]*diskQueue)
+	names := make(map[string]struct{}, len(sources))
+	for i, source := range sources {
+		if source.Name == "" {
+			return nil, fmt.Errorf("data source %d has no name", i)
+		}
+		if _, ok := names[source.Name]; ok {
+			return nil, fmt.Errorf("data source %q is not unique", source.Name)
+		}
+		names[source.Name] = struct{}{}
+
+		disk := o.disk(source)
+		if queues[disk] == nil {
+			queues[disk] = &diskQueue{}
+		}
+		queues[disk].pending = append(queues[disk].pending, i)
+	}
+	for _, q := range queues {
+		sort.SliceStable(q.pending, func(i, j int) bool {
+			return sources[q.pending[i]].Priority > sources[q.pending[j]].Priority
+		})
+	}
+
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	outcomes := make([]Outcome, len(sources))
+	for i, source := range sources {
+		outcomes[i].Name = source.Name
+	}
+
+	o.options.logger.Info("proving: orchestrating proofs",
+		zap.Int("dataSources", len(sources)),
+		zap.Int("disks", len(queues)),
+		zap.Time("deadline", deadline),
+	)
+	var wg sync.WaitGroup
+	for _, q := range queues {
+		workers := min(o.options.diskConcurrency, len(q.pending))
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(q *diskQueue) {
+				defer wg.Done()
+				o.work(ctx, q, ch, sources, outcomes)
+			}(q)
+		}
+	}
+	wg.Wait()
+	return outcomes, nil
+}
+
+func (o *Orchestrator) disk(source DataSource) string {
+	if source.Disk != "" {
+		return source.Disk
+	}
+	return source.Datadir
+}
+
+// work generates proofs for the data sources in `q` until it is empty.
+func (o *Orchestrator) work(
+	ctx context.Context,
+	q *diskQueue,
+	ch shared.Challenge,
+	sources []DataSource,
+	outcomes []Outcome,
+) {
+	for {
+		i, ok := q.next()
+		if !ok {
+			return
+		}
+		source := sources[i]
+		outcome := &outcomes[i]
+		logger := o.options.logger.With(zap.String("name", source.Name), zap.String("disk", o.disk(source)))
+
+		if err := ctx.Err(); err != nil {
+			outcome.Err = err
+			continue
+		}
+
+		outcome.Attempts++
+		logger.Info("proving: generating proof", zap.Int("attempt", outcome.Attempts))
+		start := time.Now()
+		opts := append([]OptionFunc{
+			WithDataSource(*o.options.cfg, source.NodeId, source.CommitmentAtxId, source.Datadir),
+		}, o.options.provingOpts...)
+		outcome.Proof, outcome.Metadata, outcome.Err = o.options.prover.Generate(
+			ctx, ch, *o.options.cfg, logger, opts...,
+		)
+		outcome.Duration += time.Since(start)
+
+		switch {
+		case outcome.Err == nil:
+			logger.Info("proving: generated proof", zap.Duration("duration", outcome.Duration))
+		case ctx.Err() != nil || !retryable(outcome.Err) || outcome.Attempts >= o.options.maxAttempts:
+			logger.Warn("proving: failed to generate proof",
+				zap.Int("attempts", outcome.Attempts),
+				zap.Error(outcome.Err),
+			)
+		default:
+			logger.Info("proving: retrying after failure", zap.Error(outcome.Err))
+			select {
+			case <-ctx.Done():
+				outcome.Err = fmt.Errorf("%w; last attempt failed: %w", ctx.Err(), outcome.Err)
+			case <-time.After(o.options.retryDelay):
+				q.retry(i)
+			}
+		}
+	}
+}
+
+// retryable returns whether proving might succeed if it is attempted again after failing with `err`.
+func retryable(err error) bool {
+	var errConfigMismatch shared.ConfigMismatchError
+	switch {
+	case errors.As(err, &errConfigMismatch),
+		errors.Is(err, shared.ErrInitNotCompleted),
+		errors.Is(err, initialization.ErrStateMetadataFileMissing):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,298 @@
+package proving
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/shared"
+)
+
+// fakeGenerator is a ProofGenerator that records the order and concurrency of the proofs per disk.
+type fakeGenerator struct {
+	mtx      sync.Mutex
+	disks    map[string]string // datadir -> disk
+	running  map[string]int
+	max      map[string]int
+	order    []string
+	failures map[string]int // datadir -> remaining failures
+	err      error          // returned for failures
+	delay    time.Duration
+}
+
+func newFakeGenerator(disks map[string]string) *fakeGenerator {
+	return &fakeGenerator{
+		disks:    disks,
+		running:  make(map[string]int),
+		max:      make(map[string]int),
+		failures: make(map[string]int),
+		err:      errors.New("disk hiccup"),
+		delay:    10 * time.Millisecond,
+	}
+}
+
+func (g *fakeGenerator) Generate(
+	ctx context.Context,
+	ch shared.Challenge,
+	cfg config.Config,
+	logger *zap.Logger,
+	opts ...OptionFunc,
+) (*shared.Proof, *shared.ProofMetadata, error) {
+	options, err := newOptions(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disk := g.disks[options.datadir]
+	g.mtx.Lock()
+	g.order = append(g.order, options.datadir)
+	g.running[disk]++
+	g.max[disk] = max(g.max[disk], g.running[disk])
+	g.mtx.Unlock()
+	defer func() {
+		g.mtx.Lock()
+		g.running[disk]--
+		g.mtx.Unlock()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-time.After(g.delay):
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.failures[options.datadir] > 0 {
+		g.failures[options.datadir]--
+		return nil, nil, g.err
+	}
+	return &shared.Proof{Nonce: 1}, options.proofMetadata(ch, cfg), nil
+}
+
+// fakeDataSource creates a datadir that looks completely initialized to WithDataSource.
+func fakeDataSource(t *testing.T, cfg config.Config, name, disk string) DataSource {
+	dir := t.TempDir()
+	nodeId := make([]byte, 32)
+	copy(nodeId, name)
+	commitmentAtxId := make([]byte, 32)
+
+	require.NoError(t, initialization.SaveMetadata(dir, &shared.PostMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+		NumUnits:        1,
+		MaxFileSize:     cfg.UnitSize(),
+	}))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, shared.InitFileName(0)), make([]byte, cfg.UnitSize()), 0o600))
+
+	return DataSource{
+		Name:            name,
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		Datadir:         dir,
+		Disk:            disk,
+	}
+}
+
+func disksOf(sources []DataSource) map[string]string {
+	disks := make(map[string]string)
+	for _, s := range sources {
+		disks[s.Datadir] = s.Disk
+	}
+	return disks
+}
+
+func TestOrchestrator_DiskConcurrency(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sources := []DataSource{
+		fakeDataSource(t, cfg, "a1", "a"),
+		fakeDataSource(t, cfg, "a2", "a"),
+		fakeDataSource(t, cfg, "a3", "a"),
+		fakeDataSource(t, cfg, "b1", "b"),
+		fakeDataSource(t, cfg, "b2", "b"),
+		fakeDataSource(t, cfg, "c1", "c"),
+	}
+	generator := newFakeGenerator(disksOf(sources))
+
+	o, err := NewOrchestrator(
+		WithOrchestratorProver(generator),
+		WithOrchestratorConfig(cfg),
+		WithOrchestratorLogger(zaptest.NewLogger(t)),
+		WithOrchestratorDiskConcurrency(2),
+	)
+	require.NoError(t, err)
+
+	outcomes, err := o.Run(context.Background(), shared.ZeroChallenge, time.Now().Add(time.Minute), sources)
+	require.NoError(t, err)
+	require.Len(t, outcomes, len(sources))
+	for i, outcome := range outcomes {
+		require.Equal(t, sources[i].Name, outcome.Name)
+		require.NoError(t, outcome.Err)
+		require.NotNil(t, outcome.Proof)
+		require.Equal(t, sources[i].NodeId, outcome.Metadata.NodeId)
+		require.Equal(t, 1, outcome.Attempts)
+	}
+	require.Equal(t, map[string]int{"a": 2, "b": 2, "c": 1}, generator.max)
+}
+
+func TestOrchestrator_Priority(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sources := []DataSource{
+		fakeDataSource(t, cfg, "low", "disk"),
+		fakeDataSource(t, cfg, "high", "disk"),
+		fakeDataSource(t, cfg, "mid", "disk"),
+	}
+	sources[1].Priority = 10
+	sources[2].Priority = 5
+	generator := newFakeGenerator(disksOf(sources))
+
+	o, err := NewOrchestrator(WithOrchestratorProver(generator), WithOrchestratorConfig(cfg))
+	require.NoError(t, err)
+	_, err = o.Run(context.Background(), shared.ZeroChallenge, time.Time{}, sources)
+	require.NoError(t, err)
+	require.Equal(t, []string{sources[1].Datadir, sources[2].Datadir, sources[0].Datadir}, generator.order)
+	require.Equal(t, 1, generator.max["disk"])
+}
+
+func TestOrchestrator_Retries(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sources := []DataSource{
+		fakeDataSource(t, cfg, "flaky", "disk"),
+		fakeDataSource(t, cfg, "broken", "disk"),
+		fakeDataSource(t, cfg, "healthy", "disk"),
+		fakeDataSource(t, cfg, "mismatch", "other"),
+	}
+	// a data source of another identity fails permanently
+	sources[3].NodeId = make([]byte, 32)
+	generator := newFakeGenerator(disksOf(sources))
+	generator.failures[sources[0].Datadir] = 1
+	generator.failures[sources[1].Datadir] = 10
+
+	o, err := NewOrchestrator(
+		WithOrchestratorProver(generator),
+		WithOrchestratorConfig(cfg),
+		WithOrchestratorLogger(zaptest.NewLogger(t)),
+		WithOrchestratorRetries(3, time.Millisecond),
+	)
+	require.NoError(t, err)
+	outcomes, err := o.Run(context.Background(), shared.ZeroChallenge, time.Time{}, sources)
+	require.NoError(t, err)
+
+	require.NoError(t, outcomes[0].Err)
+	require.Equal(t, 2, outcomes[0].Attempts)
+
+	require.ErrorIs(t, outcomes[1].Err, generator.err)
+	require.Equal(t, 3, outcomes[1].Attempts)
+
+	require.NoError(t, outcomes[2].Err)
+	require.Equal(t, 1, outcomes[2].Attempts)
+
+	var errConfigMismatch shared.ConfigMismatchError
+	require.ErrorAs(t, outcomes[3].Err, &errConfigMismatch)
+	require.Equal(t, 1, outcomes[3].Attempts)
+
+	// failed data sources are retried after the others on the same disk
+	require.Equal(t, []string{
+		sources[0].Datadir, sources[1].Datadir, sources[2].Datadir,
+		sources[0].Datadir, sources[1].Datadir, sources[1].Datadir,
+	}, generator.order[:6])
+}
+
+func TestOrchestrator_Deadline(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sources := []DataSource{
+		fakeDataSource(t, cfg, "first", "disk"),
+		fakeDataSource(t, cfg, "second", "disk"),
+	}
+	generator := newFakeGenerator(disksOf(sources))
+	generator.delay = time.Minute
+
+	o, err := NewOrchestrator(WithOrchestratorProver(generator), WithOrchestratorConfig(cfg))
+	require.NoError(t, err)
+	outcomes, err := o.Run(context.Background(), shared.ZeroChallenge, time.Now().Add(50*time.Millisecond), sources)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, outcomes[0].Err, context.DeadlineExceeded)
+	require.Equal(t, 1, outcomes[0].Attempts)
+	require.ErrorIs(t, outcomes[1].Err, context.DeadlineExceeded)
+	require.Zero(t, outcomes[1].Attempts)
+}
+
+func TestOrchestrator_DefaultProverOverlapsDisks(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sources := []DataSource{
+		fakeDataSource(t, cfg, "a", "a"),
+		fakeDataSource(t, cfg, "b", "b"),
+	}
+
+	// every proof waits until the proof of the other disk started
+	var started sync.WaitGroup
+	started.Add(len(sources))
+	original := generateProof
+	generateProof = func(
+		context.Context, string, []byte, *zap.Logger, uint, uint, uint, uint, [32]byte, config.PowFlags,
+	) (*shared.Proof, error) {
+		started.Done()
+		started.Wait()
+		return &shared.Proof{Nonce: 1}, nil
+	}
+	t.Cleanup(func() { generateProof = original })
+
+	o, err := NewOrchestrator(WithOrchestratorConfig(cfg), WithOrchestratorLogger(zaptest.NewLogger(t)))
+	require.NoError(t, err)
+
+	done := make(chan []Outcome, 1)
+	go func() {
+		outcomes, _ := o.Run(context.Background(), shared.ZeroChallenge, time.Time{}, sources)
+		done <- outcomes
+	}()
+	select {
+	case outcomes := <-done:
+		require.Len(t, outcomes, len(sources))
+		for _, outcome := range outcomes {
+			require.NoError(t, outcome.Err, outcome.Name)
+			require.NotNil(t, outcome.Proof, outcome.Name)
+		}
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "proofs of different disks didn't overlap")
+	}
+}
+
+func TestOrchestrator_Invalid(t *testing.T) {
+	cfg := config.DefaultConfig()
+
+	_, err := NewOrchestrator(WithOrchestratorProver(nil), WithOrchestratorConfig(cfg))
+	require.ErrorContains(t, err, "no prover provided")
+	_, err = NewOrchestrator(WithOrchestratorProver(newFakeGenerator(nil)))
+	require.ErrorContains(t, err, "no config provided")
+	_, err = NewOrchestrator(
+		WithOrchestratorProver(newFakeGenerator(nil)),
+		WithOrchestratorConfig(cfg),
+		WithOrchestratorDiskConcurrency(0),
+	)
+	require.ErrorContains(t, err, "invalid `diskConcurrency`")
+	_, err = NewOrchestrator(
+		WithOrchestratorProver(newFakeGenerator(nil)),
+		WithOrchestratorConfig(cfg),
+		WithOrchestratorRetries(0, 0),
+	)
+	require.ErrorContains(t, err, "invalid `maxAttempts`")
+
+	o, err := NewOrchestrator(WithOrchestratorProver(newFakeGenerator(nil)), WithOrchestratorConfig(cfg))
+	require.NoError(t, err)
+	_, err = o.Run(context.Background(), shared.ZeroChallenge, time.Time{}, []DataSource{{Name: "a"}, {Name: "a"}})
+	require.ErrorContains(t, err, "not unique")
+	_, err = o.Run(context.Background(), shared.ZeroChallenge, time.Time{}, []DataSource{{}})
+	require.ErrorContains(t, err, "no name")
+}
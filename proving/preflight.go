@@ -0,0 +1,154 @@
+package proving
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+// ErrMissingNonce is reported by the preflight check if the metadata of the data doesn't contain a VRF nonce.
+var ErrMissingNonce = errors.New("metadata contains no VRF nonce")
+
+// PreflightReport is the result of the health check that is run before proving if WithPreflight is set.
+type PreflightReport struct {
+	Datadir string
+	// Fraction is the percentage of labels that were sampled.
+	Fraction float64
+	// PosErr is set if a sampled label is invalid or the labels couldn't be checked.
+	PosErr error
+	// Nonce is the VRF nonce stored in the metadata.
+	Nonce *uint64
+	// NonceErr is set if the VRF nonce is missing or invalid.
+	NonceErr error
+	Duration time.Duration
+}
+
+// Healthy returns whether no problem was found.
+func (r *PreflightReport) Healthy() bool {
+	return r.PosErr == nil && r.NonceErr == nil
+}
+
+// PreflightError is returned by RequireHealthy if the preflight check found a problem.
+type PreflightError struct {
+	Report *PreflightReport
+}
+
+func (e PreflightError) Error() string {
+	return fmt.Sprintf("preflight check of %s failed: %v",
+		e.Report.Datadir, errors.Join(e.Report.PosErr, e.Report.NonceErr),
+	)
+}
+
+func (e PreflightError) Unwrap() []error {
+	return []error{e.Report.PosErr, e.Report.NonceErr}
+}
+
+// PreflightFunc decides if a proof is generated after the preflight check. Proving continues if it returns nil
+// and is stopped with the returned error otherwise.
+type PreflightFunc func(report *PreflightReport) error
+
+// RequireHealthy is the default PreflightFunc. It stops proving with a PreflightError if the data isn't healthy.
+func RequireHealthy(report *PreflightReport) error {
+	if !report.Healthy() {
+		return PreflightError{Report: report}
+	}
+	return nil
+}
+
+type preflightOption struct {
+	scrypt   config.ScryptParams
+	fraction float64
+	check    PreflightFunc
+}
+
+// WithPreflight checks the health of the data before proving. It verifies `fraction` percent of the labels,
+// sampled randomly, and the VRF nonce stored in the metadata. `scrypt` are the scrypt params the data was
+// initialized with. The findings are passed to `check`, which decides whether to prove anyway. If `check` is nil
+// RequireHealthy is used.
+func WithPreflight(scrypt config.ScryptParams, fraction float64, check PreflightFunc) OptionFunc {
+	return func(o *option) error {
+		if fraction <= 0 || fraction > 100 {
+			return fmt.Errorf("invalid `fraction`; expected: > 0 and <= 100, given: %v", fraction)
+		}
+		if check == nil {
+			check = RequireHealthy
+		}
+		o.preflight = &preflightOption{
+			scrypt:   scrypt,
+			fraction: fraction,
+			check:    check,
+		}
+		return nil
+	}
+}
+
+// preflight runs the preflight check if it is enabled and returns the decision of its PreflightFunc.
+// If `ctx` is canceled ctx.Err() is returned after the running step. Verifying the labels can't be interrupted.
+func preflight(ctx context.Context, options *option, logger *zap.Logger) error {
+	if options.preflight == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m, err := initialization.LoadMetadata(options.datadir)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("proving: running preflight check", zap.Float64("fraction", options.preflight.fraction))
+	start := time.Now()
+	report := &PreflightReport{
+		Datadir:  options.datadir,
+		Fraction: options.preflight.fraction,
+		Nonce:    m.Nonce,
+	}
+
+	scrypt := options.preflight.scrypt
+	report.PosErr = postrs.VerifyPos(
+		options.datadir,
+		postrs.NewScryptParams(scrypt.N, scrypt.R, scrypt.P),
+		postrs.WithFraction(options.preflight.fraction),
+		postrs.VerifyPosWithLogger(logger),
+	)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	report.NonceErr = verifyNonce(m, scrypt)
+	report.Duration = time.Since(start)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	logger.Info("proving: preflight check done",
+		zap.Bool("healthy", report.Healthy()),
+		zap.NamedError("posErr", report.PosErr),
+		zap.NamedError("nonceErr", report.NonceErr),
+		zap.Duration("duration", report.Duration),
+	)
+	return options.preflight.check(report)
+}
+
+// verifyNonce checks the VRF nonce in `m` with verifying.VerifyVRFNonce.
+func verifyNonce(m *shared.PostMetadata, scrypt config.ScryptParams) error {
+	if m.Nonce == nil {
+		return ErrMissingNonce
+	}
+	return verifying.VerifyVRFNonce(m.Nonce, &shared.VRFNonceMetadata{
+		NodeId:          m.NodeId,
+		CommitmentAtxId: m.CommitmentAtxId,
+		NumUnits:        m.NumUnits,
+		LabelsPerUnit:   m.LabelsPerUnit,
+	}, verifying.WithLabelScryptParams(scrypt))
+}
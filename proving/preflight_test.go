@@ -0,0 +1,138 @@
+package proving
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestPreflight(t *testing.T) {
+	log := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	cfg, opts := getTestConfig(t)
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(log),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	errStop := errors.New("stop")
+	generate := func(t *testing.T, check PreflightFunc) error {
+		_, _, err := Generate(
+			context.Background(),
+			shared.ZeroChallenge,
+			cfg,
+			log,
+			WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+			WithPreflight(opts.Scrypt, 100, check),
+			LightMode(),
+		)
+		return err
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		var report *PreflightReport
+		err := generate(t, func(r *PreflightReport) error {
+			report = r
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+		require.True(t, report.Healthy())
+		require.Equal(t, opts.DataDir, report.Datadir)
+		require.EqualValues(t, 100, report.Fraction)
+		require.Equal(t, init.Nonce(), report.Nonce)
+	})
+
+	t.Run("missing nonce", func(t *testing.T) {
+		m, err := initialization.LoadMetadata(opts.DataDir)
+		require.NoError(t, err)
+		nonce := m.Nonce
+		m.Nonce = nil
+		require.NoError(t, initialization.SaveMetadata(opts.DataDir, m))
+		t.Cleanup(func() {
+			m.Nonce = nonce
+			require.NoError(t, initialization.SaveMetadata(opts.DataDir, m))
+		})
+
+		err = generate(t, nil)
+		var errPreflight PreflightError
+		require.ErrorAs(t, err, &errPreflight)
+		require.NoError(t, errPreflight.Report.PosErr)
+		require.ErrorIs(t, err, ErrMissingNonce)
+	})
+
+	t.Run("corrupted data", func(t *testing.T) {
+		file, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = file.WriteAt([]byte("1234567890123456"), 0)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		err = generate(t, nil)
+		var errPreflight PreflightError
+		require.ErrorAs(t, err, &errPreflight)
+		require.ErrorIs(t, err, postrs.ErrInvalidPos)
+		require.NoError(t, errPreflight.Report.NonceErr)
+
+		// the caller can decide to prove anyway
+		var report *PreflightReport
+		err = generate(t, func(r *PreflightReport) error {
+			report = r
+			return nil
+		})
+		require.NotErrorIs(t, err, postrs.ErrInvalidPos)
+		require.False(t, report.Healthy())
+	})
+}
+
+func TestPreflight_Canceled(t *testing.T) {
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	cfg, opts := getTestConfig(t)
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = Generate(ctx, shared.ZeroChallenge, cfg, zaptest.NewLogger(t),
+		WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		WithPreflight(opts.Scrypt, 100, func(*PreflightReport) error {
+			require.Fail(t, "preflight check must not run after cancellation")
+			return nil
+		}),
+	)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPreflight_InvalidFraction(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	for _, fraction := range []float64{0, -1, 101} {
+		_, _, err := Generate(context.Background(), shared.ZeroChallenge, cfg, zaptest.NewLogger(t),
+			WithPreflight(opts.Scrypt, fraction, nil),
+		)
+		require.ErrorContains(t, err, "invalid `fraction`")
+	}
+}
@@ -1,11 +1,10 @@
 package proving
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"strconv"
 
 	"go.uber.org/zap"
 
@@ -15,6 +14,21 @@ import (
 	"github.com/spacemeshos/post/shared"
 )
 
+// generateProof is the call into libpost used by Generate. Tests replace it to simulate proofs.
+var generateProof = postrs.GenerateProofContext
+
+// ErrProofAbandoned is returned by Generate if `ctx` is canceled while libpost generates the proof, see Generate.
+var ErrProofAbandoned = postrs.ErrProofAbandoned
+
+// Generate generates a proof for `ch` from the data source set with WithDataSource.
+//
+// Proofs for the same data directory are generated one at a time: concurrent calls of Generate for the same
+// directory are serialized, each one waits until libpost finished the proofs started before.
+//
+// If `ctx` is canceled Generate returns without waiting for the proof. Cancellation doesn't stop the work if
+// libpost already started to generate the proof: libpost can't abort a running proof, it keeps reading the data
+// until it finished and its result is discarded. The returned error is ErrProofAbandoned wrapping ctx.Err() in
+// that case, the data directory stays busy and the next Generate for it waits until libpost finished.
 func Generate(
 	ctx context.Context,
 	ch shared.Challenge,
@@ -22,29 +36,29 @@ func Generate(
 	logger *zap.Logger,
 	opts ...OptionFunc,
 ) (*shared.Proof, *shared.ProofMetadata, error) {
-	options := option{
-		threads:  1,
-		nonces:   16,
-		powFlags: config.DefaultProvingPowFlags(),
-	}
-	for _, opt := range opts {
-		if err := opt(&options); err != nil {
-			return nil, nil, err
-		}
+	options, err := newOptions(opts...)
+	if err != nil {
+		return nil, nil, err
 	}
-	if err := options.validate(); err != nil {
+	if err := preflight(ctx, options, logger); err != nil {
 		return nil, nil, err
 	}
 
-	result, err := postrs.GenerateProof(
+	result, err := generateProof(
+		ctx,
 		options.datadir,
 		ch, logger,
 		options.nonces,
 		options.threads,
 		cfg.K1, cfg.K2,
-		cfg.PowDifficulty, options.powFlags,
+		cfg.PowDifficulty,
+		options.powFlags,
 	)
-	if err != nil {
+	switch {
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		logger.Info("proving: stopped", zap.Error(err))
+		return nil, nil, err
+	case err != nil:
 		return nil, nil, fmt.Errorf("generating proof: %w", err)
 	}
 	logger.Info("proving: generated proof")
@@ -55,45 +69,11 @@ func Generate(
 	)
 
 	proof := &shared.Proof{Nonce: result.Nonce, Indices: result.Indices, Pow: result.Pow}
-	proofMetadata := &shared.ProofMetadata{
-		NodeId:          options.nodeId,
-		CommitmentAtxId: options.commitmentAtxId,
-		Challenge:       ch,
-		LabelsPerUnit:   cfg.LabelsPerUnit,
-		NumUnits:        options.numUnits,
-	}
-	return proof, proofMetadata, nil
-}
-
-func verifyMetadata(m *shared.PostMetadata, cfg config.Config, datadir string, nodeId, commitmentAtxId []byte) error {
-	if !bytes.Equal(nodeId, m.NodeId) {
-		return shared.ConfigMismatchError{
-			Param:    "NodeId",
-			Expected: hex.EncodeToString(nodeId),
-			Found:    hex.EncodeToString(m.NodeId),
-			DataDir:  datadir,
-		}
-	}
-
-	if !bytes.Equal(commitmentAtxId, m.CommitmentAtxId) {
-		return shared.ConfigMismatchError{
-			Param:    "CommitmentAtxId",
-			Expected: hex.EncodeToString(commitmentAtxId),
-			Found:    hex.EncodeToString(m.CommitmentAtxId),
-			DataDir:  datadir,
-		}
-	}
-
-	if cfg.LabelsPerUnit != m.LabelsPerUnit {
-		return shared.ConfigMismatchError{
-			Param:    "LabelsPerUnit",
-			Expected: strconv.FormatUint(cfg.LabelsPerUnit, 10),
-			Found:    strconv.FormatUint(m.LabelsPerUnit, 10),
-			DataDir:  datadir,
-		}
+	metadata := options.proofMetadata(ch, cfg)
+	if err := selfVerify(options, proof, metadata, cfg, logger); err != nil {
+		return nil, nil, err
 	}
-
-	return nil
+	return proof, metadata, nil
 }
 
 // TODO(mafa): this should be part of the new persistence package
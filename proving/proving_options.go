@@ -5,6 +5,7 @@ import (
 
 	"github.com/spacemeshos/post/config"
 	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/persistence"
 	"github.com/spacemeshos/post/shared"
 )
 
@@ -19,6 +20,10 @@ type option struct {
 	// How many threads to use to generate a proof.
 	// 0 - automatically detect
 	threads uint
+	// Health check run before proving, see WithPreflight.
+	preflight *preflightOption
+	// Verification of the generated proof, see WithSelfVerification.
+	selfVerification *selfVerificationOption
 }
 
 func (o *option) validate() error {
@@ -34,6 +39,44 @@ func (o *option) validate() error {
 
 type OptionFunc func(*option) error
 
+func defaultOptions() *option {
+	return &option{
+		threads:  1,
+		nonces:   16,
+		powFlags: config.DefaultProvingPowFlags(),
+	}
+}
+
+func newOptions(opts ...OptionFunc) (*option, error) {
+	options := defaultOptions()
+	if err := options.apply(opts...); err != nil {
+		return nil, err
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (o *option) apply(opts ...OptionFunc) error {
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *option) proofMetadata(ch shared.Challenge, cfg config.Config) *shared.ProofMetadata {
+	return &shared.ProofMetadata{
+		NodeId:          o.nodeId,
+		CommitmentAtxId: o.commitmentAtxId,
+		Challenge:       ch,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+		NumUnits:        o.numUnits,
+	}
+}
+
 // WithDataSource sets the data source to use for the proof.
 func WithDataSource(cfg config.Config, nodeId, commitmentAtxId []byte, datadir string) OptionFunc {
 	return func(o *option) error {
@@ -42,7 +85,7 @@ func WithDataSource(cfg config.Config, nodeId, commitmentAtxId []byte, datadir s
 			return err
 		}
 
-		if err := verifyMetadata(m, cfg, datadir, nodeId, commitmentAtxId); err != nil {
+		if err := persistence.VerifyMetadata(m, datadir, nodeId, commitmentAtxId, cfg.LabelsPerUnit); err != nil {
 			return err
 		}
 
@@ -60,6 +103,8 @@ func WithDataSource(cfg config.Config, nodeId, commitmentAtxId []byte, datadir s
 	}
 }
 
+// WithPowFlags sets the flags of the PoW of a proof. libpost keeps no PoW state between proofs, so every call of
+// Generate sets it up again: with config.PowFastMode the RandomX dataset is built for every proof.
 func WithPowFlags(flags config.PowFlags) OptionFunc {
 	return func(o *option) error {
 		o.powFlags = flags
@@ -81,6 +81,16 @@ func Test_Generate(t *testing.T) {
 			indexBitSize := uint(shared.BinaryRepresentationMinBits(numLabels))
 			r.Equal(shared.Size(indexBitSize, uint(cfg.K2)), uint(len(proof.Indices)))
 
+			indices, err := shared.DecodeIndices(proof.Indices, numLabels, cfg.K2)
+			r.NoError(err)
+			r.Len(indices, int(cfg.K2))
+			for _, index := range indices {
+				r.Less(index, numLabels)
+			}
+			encoded, err := shared.EncodeIndices(indices, numLabels)
+			r.NoError(err)
+			r.Equal(proof.Indices, encoded)
+
 			log.Info("post status",
 				zap.Uint64("numLabels", numLabels),
 				zap.Int("indices size", len(proof.Indices)),
@@ -168,3 +178,30 @@ func Test_Generate_DetectInvalidParameters(t *testing.T) {
 		require.Equal(t, "LabelsPerUnit", errConfigMismatch.Param)
 	})
 }
+
+func TestGenerate_Canceled(t *testing.T) {
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	cfg, opts := getTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(zaptest.NewLogger(t)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	proof, metadata, err := Generate(ctx, shared.ZeroChallenge, cfg, zaptest.NewLogger(t),
+		WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		LightMode(),
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	// libpost was never called
+	require.NotErrorIs(t, err, ErrProofAbandoned)
+	require.Nil(t, proof)
+	require.Nil(t, metadata)
+}
@@ -0,0 +1,181 @@
+package proving
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+// Verifier verifies proofs. It is implemented by verifying.ProofVerifier.
+type Verifier interface {
+	VerifyProof(
+		proof *shared.Proof,
+		metadata *shared.ProofMetadata,
+		logger *zap.Logger,
+		cfg postrs.Config,
+		scryptParams postrs.ScryptParams,
+		opts ...postrs.VerifyOptionFunc,
+	) error
+}
+
+// SelfVerificationMode selects the indices of a generated proof that are verified with WithSelfVerification.
+type SelfVerificationMode struct {
+	verify bool
+	subset bool
+	k3     uint
+}
+
+// VerifyAllIndices verifies every index of the proof.
+func VerifyAllIndices() SelfVerificationMode {
+	return SelfVerificationMode{verify: true}
+}
+
+// VerifySubset verifies K3 randomly selected indices of the proof. The node id is used as seed.
+func VerifySubset(k3 uint) SelfVerificationMode {
+	return SelfVerificationMode{verify: true, subset: true, k3: k3}
+}
+
+// VerifyNone doesn't verify the proof.
+func VerifyNone() SelfVerificationMode {
+	return SelfVerificationMode{}
+}
+
+// InvalidProofError is returned if a generated proof fails self verification.
+type InvalidProofError struct {
+	// Ordinal is the position of the invalid index in the proof or -1 if the failure isn't caused by an index.
+	Ordinal int
+	// Index is the label index at Ordinal.
+	Index uint64
+	Err   error
+	// Proof and Metadata are the generated proof that failed verification, e.g. to store it for inspection.
+	Proof    *shared.Proof
+	Metadata *shared.ProofMetadata
+}
+
+func (e InvalidProofError) Error() string {
+	if e.Ordinal < 0 {
+		return fmt.Sprintf("generated proof is invalid: %v", e.Err)
+	}
+	return fmt.Sprintf("generated proof is invalid: index %d (label %d): %v", e.Ordinal, e.Index, e.Err)
+}
+
+func (e InvalidProofError) Unwrap() error {
+	return e.Err
+}
+
+type selfVerificationOption struct {
+	mode     SelfVerificationMode
+	scrypt   config.ScryptParams
+	verifier Verifier
+}
+
+// clone returns a copy of `o` or a zero option if `o` is nil. It is never modified in place, so that a copy of an
+// option struct doesn't share it with the original.
+func (o *selfVerificationOption) clone() *selfVerificationOption {
+	if o == nil {
+		return &selfVerificationOption{}
+	}
+	c := *o
+	return &c
+}
+
+// WithSelfVerification verifies a generated proof before it is returned. `scrypt` are the scrypt params the data
+// was initialized with. The proof is verified with the verifier set with WithVerifier or a verifier shared by all
+// proofs of this package that is created on first use. An invalid proof is returned as InvalidProofError.
+func WithSelfVerification(mode SelfVerificationMode, scrypt config.ScryptParams) OptionFunc {
+	return func(o *option) error {
+		if mode.subset && mode.k3 == 0 {
+			return errors.New("invalid `k3`; expected: > 0, given: 0")
+		}
+		sv := o.selfVerification.clone()
+		sv.mode = mode
+		sv.scrypt = scrypt
+		o.selfVerification = sv
+		return nil
+	}
+}
+
+// WithVerifier sets the verifier used by WithSelfVerification, e.g. a verifying.ProofVerifier.
+func WithVerifier(verifier Verifier) OptionFunc {
+	return func(o *option) error {
+		if verifier == nil {
+			return errors.New("verifier is nil")
+		}
+		sv := o.selfVerification.clone()
+		sv.verifier = verifier
+		o.selfVerification = sv
+		return nil
+	}
+}
+
+var cachedVerifier struct {
+	sync.Mutex
+	*postrs.Verifier
+}
+
+// defaultVerifier returns the verifier shared by all self verifications without a verifier set with WithVerifier.
+// It is never closed.
+func defaultVerifier() (Verifier, error) {
+	cachedVerifier.Lock()
+	defer cachedVerifier.Unlock()
+	if cachedVerifier.Verifier == nil {
+		verifier, err := postrs.NewVerifier(config.DefaultVerifyingPowFlags())
+		if err != nil {
+			return nil, fmt.Errorf("creating verifier: %w", err)
+		}
+		cachedVerifier.Verifier = verifier
+	}
+	return cachedVerifier.Verifier, nil
+}
+
+// selfVerify verifies `proof` if self verification is enabled.
+func selfVerify(
+	options *option,
+	proof *shared.Proof,
+	metadata *shared.ProofMetadata,
+	cfg config.Config,
+	logger *zap.Logger,
+) error {
+	sv := options.selfVerification
+	if sv == nil || !sv.mode.verify {
+		return nil
+	}
+
+	verifier := sv.verifier
+	if verifier == nil {
+		var err error
+		if verifier, err = defaultVerifier(); err != nil {
+			return err
+		}
+	}
+
+	mode := postrs.VerifyAll()
+	if sv.mode.subset {
+		mode = postrs.VerifySubset(sv.mode.k3, metadata.NodeId)
+	}
+	scrypt := postrs.NewScryptParams(sv.scrypt.N, sv.scrypt.R, sv.scrypt.P)
+	err := verifier.VerifyProof(proof, metadata, logger, postrs.Config(cfg), scrypt, mode)
+	if err == nil {
+		logger.Debug("proving: verified generated proof")
+		return nil
+	}
+
+	invalid := InvalidProofError{Ordinal: -1, Err: err, Proof: proof, Metadata: metadata}
+	var errInvalidIndex *postrs.ErrInvalidIndex
+	if errors.As(err, &errInvalidIndex) {
+		invalid.Ordinal = errInvalidIndex.Index
+		numLabels := uint64(metadata.NumUnits) * metadata.LabelsPerUnit
+		indices, err := shared.DecodeIndices(proof.Indices, numLabels, cfg.K2)
+		if err == nil && invalid.Ordinal < len(indices) {
+			invalid.Index = indices[invalid.Ordinal]
+		}
+	}
+	logger.Error("proving: generated proof is invalid", zap.Error(invalid))
+	return invalid
+}
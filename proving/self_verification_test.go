@@ -0,0 +1,138 @@
+package proving
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+type fakeVerifier struct {
+	calls int
+	err   error
+}
+
+func (v *fakeVerifier) VerifyProof(
+	proof *shared.Proof,
+	metadata *shared.ProofMetadata,
+	logger *zap.Logger,
+	cfg postrs.Config,
+	scryptParams postrs.ScryptParams,
+	opts ...postrs.VerifyOptionFunc,
+) error {
+	v.calls++
+	return v.err
+}
+
+func TestSelfVerify(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.K2 = 3
+	metadata := &shared.ProofMetadata{
+		NodeId:          make([]byte, 32),
+		CommitmentAtxId: make([]byte, 32),
+		Challenge:       make([]byte, 32),
+		NumUnits:        1,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	indices, err := shared.EncodeIndices([]uint64{7, 300, 511}, cfg.LabelsPerUnit)
+	require.NoError(t, err)
+	proof := &shared.Proof{Indices: indices}
+
+	selfVerifyWith := func(t *testing.T, verifier Verifier, mode SelfVerificationMode) error {
+		options, err := newOptions(
+			func(o *option) error { o.datadir = t.TempDir(); return nil },
+			WithSelfVerification(mode, config.DefaultLabelParams()),
+			WithVerifier(verifier),
+		)
+		require.NoError(t, err)
+		return selfVerify(options, proof, metadata, cfg, zaptest.NewLogger(t))
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		verifier := &fakeVerifier{}
+		require.NoError(t, selfVerifyWith(t, verifier, VerifyAllIndices()))
+		require.NoError(t, selfVerifyWith(t, verifier, VerifySubset(2)))
+		require.Equal(t, 2, verifier.calls)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		verifier := &fakeVerifier{err: errors.New("invalid")}
+		require.NoError(t, selfVerifyWith(t, verifier, VerifyNone()))
+		require.Zero(t, verifier.calls)
+	})
+
+	t.Run("invalid index", func(t *testing.T) {
+		verifier := &fakeVerifier{err: &postrs.ErrInvalidIndex{Index: 1}}
+		err := selfVerifyWith(t, verifier, VerifyAllIndices())
+		var errInvalidProof InvalidProofError
+		require.ErrorAs(t, err, &errInvalidProof)
+		require.Equal(t, 1, errInvalidProof.Ordinal)
+		require.EqualValues(t, 300, errInvalidProof.Index)
+		require.ErrorIs(t, err, verifier.err)
+	})
+
+	t.Run("other failure", func(t *testing.T) {
+		verifier := &fakeVerifier{err: errors.New("invalid pow")}
+		err := selfVerifyWith(t, verifier, VerifySubset(1))
+		var errInvalidProof InvalidProofError
+		require.ErrorAs(t, err, &errInvalidProof)
+		require.Equal(t, -1, errInvalidProof.Ordinal)
+		require.ErrorIs(t, err, verifier.err)
+	})
+}
+
+func TestSelfVerify_DefaultVerifier(t *testing.T) {
+	options, err := newOptions(
+		func(o *option) error { o.datadir = t.TempDir(); return nil },
+		WithSelfVerification(VerifyAllIndices(), config.DefaultLabelParams()),
+	)
+	require.NoError(t, err)
+
+	// the proof is rejected by the shared verifier
+	metadata := &shared.ProofMetadata{
+		NodeId:          make([]byte, 32),
+		CommitmentAtxId: make([]byte, 32),
+		Challenge:       make([]byte, 32),
+		NumUnits:        1,
+		LabelsPerUnit:   512,
+	}
+	err = selfVerify(options, &shared.Proof{Indices: []byte{1}}, metadata, config.DefaultConfig(), zaptest.NewLogger(t))
+	var errInvalidProof InvalidProofError
+	require.ErrorAs(t, err, &errInvalidProof)
+
+	first, err := defaultVerifier()
+	require.NoError(t, err)
+	second, err := defaultVerifier()
+	require.NoError(t, err)
+	require.Same(t, first, second)
+}
+
+func TestWithSelfVerification_Invalid(t *testing.T) {
+	_, err := newOptions(WithSelfVerification(VerifySubset(0), config.DefaultLabelParams()))
+	require.ErrorContains(t, err, "invalid `k3`")
+	_, err = newOptions(WithVerifier(nil))
+	require.ErrorContains(t, err, "verifier is nil")
+}
+
+func TestSelfVerification_OptionsNotShared(t *testing.T) {
+	defaults := defaultOptions()
+	require.NoError(t, defaults.apply(WithSelfVerification(VerifyAllIndices(), config.DefaultLabelParams())))
+
+	// a copy of the options must not share the self verification with the original
+	options := *defaults
+	verifier := &fakeVerifier{}
+	err := options.apply(WithVerifier(verifier), WithSelfVerification(VerifySubset(2), config.ScryptParams{}))
+	require.NoError(t, err)
+	require.Same(t, verifier, options.selfVerification.verifier)
+	require.Equal(t, VerifySubset(2), options.selfVerification.mode)
+
+	require.Nil(t, defaults.selfVerification.verifier)
+	require.Equal(t, VerifyAllIndices(), defaults.selfVerification.mode)
+	require.Equal(t, config.DefaultLabelParams(), defaults.selfVerification.scrypt)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// maxStatusSize limits the size of a single Status message read by the client.
+const maxStatusSize = 1 << 20
+
+// Client requests proofs from a Server.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a client for the server at `baseURL`, e.g. "http://localhost:9094".
+// If `httpClient` is nil http.DefaultClient is used.
+func NewClient(baseURL string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url %q; expected: http or https scheme", baseURL)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    httpClient,
+	}, nil
+}
+
+// Datadirs returns the names of the data directories served by the server.
+func (c *Client) Datadirs(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+datadirsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting datadirs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var names []string
+	if err := json.NewDecoder(resp.Body).Decode(&names); err != nil {
+		return nil, fmt.Errorf("decoding datadirs: %w", err)
+	}
+	return names, nil
+}
+
+// Generate requests a proof for `ch` from the data directory `datadir` and waits until it was generated.
+// `onStatus` is called for every status message received while the proof is generated; it may be nil.
+//
+// ErrDatadirBusy is returned if the server is already generating a proof for the data directory and
+// ErrDatadirNotFound if it doesn't serve it.
+func (c *Client) Generate(
+	ctx context.Context,
+	datadir string,
+	ch shared.Challenge,
+	onStatus func(Status),
+) (*shared.Proof, *shared.ProofMetadata, error) {
+	body, err := json.Marshal(ProofRequest{Challenge: shared.HexBytes(ch)})
+	if err != nil {
+		return nil, nil, err
+	}
+	endpoint := c.baseURL + datadirsPath + "/" + url.PathEscape(datadir) + proofSuffix
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("requesting proof: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil, fmt.Errorf("%w: %s", ErrDatadirNotFound, datadir)
+	case http.StatusConflict:
+		return nil, nil, fmt.Errorf("%w: %s", ErrDatadirBusy, datadir)
+	default:
+		return nil, nil, responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxStatusSize)
+	for scanner.Scan() {
+		var status Status
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			return nil, nil, fmt.Errorf("decoding status: %w", err)
+		}
+		if onStatus != nil {
+			onStatus(status)
+		}
+
+		switch status.State {
+		case StateDone:
+			if status.Proof == nil || status.Metadata == nil {
+				return nil, nil, errors.New("server returned no proof")
+			}
+			return status.Proof, status.Metadata, nil
+		case StateFailed:
+			return nil, nil, fmt.Errorf("server failed to generate proof: %s", status.Error)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("reading status: %w", err)
+	}
+	return nil, nil, errors.New("status stream ended before the proof was generated")
+}
+
+// responseError converts the response of a rejected request into an error.
+func responseError(resp *http.Response) error {
+	var body errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		body.Error = resp.Status
+	}
+	return fmt.Errorf("request failed (%s): %s", resp.Status, body.Error)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+)
+
+type option struct {
+	cfg    config.Config
+	logger *zap.Logger
+	// datadirs maps the names of the served data directories to their cleaned absolute path.
+	datadirs map[string]string
+
+	threads  uint
+	nonces   uint
+	powFlags config.PowFlags
+
+	statusInterval time.Duration
+	prove          proveFunc
+}
+
+func (o *option) validate() error {
+	if len(o.datadirs) == 0 {
+		return errors.New("at least one datadir is required")
+	}
+	if o.nonces == 0 {
+		return errors.New("`nonces` must be greater than 0")
+	}
+	if o.statusInterval <= 0 {
+		return fmt.Errorf("invalid `statusInterval`; expected: > 0, given: %v", o.statusInterval)
+	}
+	return nil
+}
+
+type OptionFunc func(*option) error
+
+// WithConfig sets the config used to generate proofs.
+func WithConfig(cfg config.Config) OptionFunc {
+	return func(o *option) error {
+		o.cfg = cfg
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the server.
+func WithLogger(logger *zap.Logger) OptionFunc {
+	return func(o *option) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithDatadir adds an initialized data directory that is served under `name`. The identity of the data directory
+// is read from its metadata when a proof is requested. A data directory can be served under several names, it's
+// busy for all of them while a proof is generated.
+func WithDatadir(name, path string) OptionFunc {
+	return func(o *option) error {
+		if name == "" {
+			return errors.New("datadir name is empty")
+		}
+		if _, ok := o.datadirs[name]; ok {
+			return fmt.Errorf("datadir %q already added", name)
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid datadir %q: %w", name, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("invalid datadir %q: %w", name, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid datadir %q: %s is not a directory", name, path)
+		}
+		o.datadirs[name] = path
+		return nil
+	}
+}
+
+// WithThreads sets the number of threads used to generate a proof. 0 detects the number automatically.
+func WithThreads(threads uint) OptionFunc {
+	return func(o *option) error {
+		o.threads = threads
+		return nil
+	}
+}
+
+// WithNonces sets the number of nonces tried in parallel to generate a proof.
+func WithNonces(nonces uint) OptionFunc {
+	return func(o *option) error {
+		if nonces == 0 {
+			return errors.New("`nonces` must be greater than 0")
+		}
+		o.nonces = nonces
+		return nil
+	}
+}
+
+// WithPowFlags sets the flags of the proof of work.
+func WithPowFlags(flags config.PowFlags) OptionFunc {
+	return func(o *option) error {
+		o.powFlags = flags
+		return nil
+	}
+}
+
+// WithStatusInterval sets the interval in which the status of a running proof is sent to the client.
+func WithStatusInterval(interval time.Duration) OptionFunc {
+	return func(o *option) error {
+		o.statusInterval = interval
+		return nil
+	}
+}
+
+// withProveFunc replaces proof generation, so the server can be tested without initialized data.
+func withProveFunc(prove proveFunc) OptionFunc {
+	return func(o *option) error {
+		o.prove = prove
+		return nil
+	}
+}
@@ -0,0 +1,312 @@
+// Package service exposes proof generation for local PoST data directories over HTTP.
+//
+// A client requests a proof for a data directory served by the Server with
+//
+//	POST /v1/datadirs/{name}/proof
+//	{"Challenge": "<32 bytes hex>"}
+//
+// The response is a stream of newline delimited JSON encoded Status messages. The last message has the state
+// StateDone and contains the proof and its metadata or the state StateFailed and contains the error.
+// Only one proof is generated for a data directory at a time, concurrent requests for the same data directory are
+// rejected with 409 Conflict. Canceling a request doesn't stop its proof: libpost can't abort a running proof, so
+// the data directory stays busy until the proof finished and its result is discarded. Data directories are
+// identified by their absolute path, a data directory served under several names is busy for all of them.
+//
+// `postcli -serve` runs a Server.
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/proving"
+	"github.com/spacemeshos/post/shared"
+)
+
+const (
+	datadirsPath = "/v1/datadirs"
+	proofSuffix  = "/proof"
+
+	contentTypeJSON   = "application/json"
+	contentTypeStream = "application/x-ndjson"
+)
+
+var (
+	// ErrDatadirNotFound is returned when a proof is requested for a data directory that isn't served.
+	ErrDatadirNotFound = errors.New("datadir not found")
+	// ErrDatadirBusy is returned when a proof is requested for a data directory that is already being proven.
+	ErrDatadirBusy = errors.New("datadir is busy")
+)
+
+// State is the state of a proof request reported in a Status.
+type State string
+
+const (
+	// StateAccepted is sent once after the request was accepted and proving started.
+	StateAccepted State = "accepted"
+	// StateProving is sent periodically while the proof is generated.
+	StateProving State = "proving"
+	// StateDone is the final state of a successful request.
+	StateDone State = "done"
+	// StateFailed is the final state of a failed request.
+	StateFailed State = "failed"
+)
+
+// Status is a message in the response stream of a proof request.
+type Status struct {
+	State   State
+	Datadir string
+	// Elapsed is the time since proving started.
+	Elapsed time.Duration
+
+	Proof    *shared.Proof         `json:",omitempty"`
+	Metadata *shared.ProofMetadata `json:",omitempty"`
+	Error    string                `json:",omitempty"`
+}
+
+// ProofRequest is the body of a proof request.
+type ProofRequest struct {
+	Challenge shared.HexBytes
+}
+
+// errorResponse is the body of a response for a rejected request.
+type errorResponse struct {
+	Error string
+}
+
+type proveFunc func(
+	ctx context.Context,
+	ch shared.Challenge,
+	datadir string,
+) (*shared.Proof, *shared.ProofMetadata, error)
+
+// datadir is a data directory served by the Server. Names that refer to the same path share it.
+type datadir struct {
+	path string
+	busy sync.Mutex
+}
+
+// Server generates proofs for the data directories it serves. It implements http.Handler.
+type Server struct {
+	cfg            config.Config
+	logger         *zap.Logger
+	provingOpts    []proving.OptionFunc
+	statusInterval time.Duration
+	datadirs       map[string]*datadir
+	prove          proveFunc
+}
+
+// NewServer creates a Server for the given data directories.
+func NewServer(opts ...OptionFunc) (*Server, error) {
+	options := &option{
+		cfg:            config.DefaultConfig(),
+		logger:         zap.NewNop(),
+		threads:        1,
+		nonces:         16,
+		powFlags:       config.DefaultProvingPowFlags(),
+		statusInterval: 10 * time.Second,
+		datadirs:       make(map[string]string),
+	}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:    options.cfg,
+		logger: options.logger,
+		provingOpts: []proving.OptionFunc{
+			proving.WithThreads(options.threads),
+			proving.WithNonces(options.nonces),
+			proving.WithPowFlags(options.powFlags),
+		},
+		statusInterval: options.statusInterval,
+		datadirs:       make(map[string]*datadir, len(options.datadirs)),
+		prove:          options.prove,
+	}
+	// the busy check is keyed by path, so a datadir served under several names is proven only once at a time
+	byPath := make(map[string]*datadir, len(options.datadirs))
+	for name, path := range options.datadirs {
+		dir, ok := byPath[path]
+		if !ok {
+			dir = &datadir{path: path}
+			byPath[path] = dir
+		}
+		s.datadirs[name] = dir
+	}
+	if s.prove == nil {
+		s.prove = s.generate
+	}
+	return s, nil
+}
+
+// Datadirs returns the sorted names of the data directories served by the server.
+func (s *Server) Datadirs() []string {
+	names := make([]string, 0, len(s.datadirs))
+	for name := range s.datadirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == datadirsPath:
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		json.NewEncoder(w).Encode(s.Datadirs())
+	case strings.HasPrefix(r.URL.Path, datadirsPath+"/") && strings.HasSuffix(r.URL.Path, proofSuffix):
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, datadirsPath+"/"), proofSuffix)
+		s.handleProof(w, r, name)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+	}
+}
+
+func (s *Server) handleProof(w http.ResponseWriter, r *http.Request, name string) {
+	dir, ok := s.datadirs[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", ErrDatadirNotFound, name))
+		return
+	}
+
+	var req ProofRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if len(req.Challenge) != 32 {
+		writeError(w, http.StatusBadRequest,
+			fmt.Errorf("invalid `Challenge` length; expected: 32, given: %d", len(req.Challenge)),
+		)
+		return
+	}
+
+	if !dir.busy.TryLock() {
+		writeError(w, http.StatusConflict, fmt.Errorf("%w: %s", ErrDatadirBusy, name))
+		return
+	}
+
+	logger := s.logger.With(zap.String("datadir", name))
+	logger.Info("service: generating proof", zap.String("challenge", fmt.Sprintf("%x", req.Challenge)))
+
+	w.Header().Set("Content-Type", contentTypeStream)
+	w.WriteHeader(http.StatusOK)
+	stream := newStatusWriter(w)
+
+	type result struct {
+		proof    *shared.Proof
+		metadata *shared.ProofMetadata
+		err      error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		// the datadir is released before the final status is sent, so the client can request the next proof
+		// as soon as it received the result.
+		// libpost can't abort a running proof, so `prove` isn't canceled with the request. If the client goes
+		// away the proof is still generated in the background and the datadir stays busy until it finished.
+		defer dir.busy.Unlock()
+		proof, metadata, err := s.prove(context.WithoutCancel(r.Context()), shared.Challenge(req.Challenge), dir.path)
+		done <- result{proof, metadata, err}
+	}()
+
+	// Writes to the stream are best effort.
+	stream.write(Status{State: StateAccepted, Datadir: name})
+
+	ticker := time.NewTicker(s.statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stream.write(Status{State: StateProving, Datadir: name, Elapsed: time.Since(start)})
+		case res := <-done:
+			status := Status{Datadir: name, Elapsed: time.Since(start)}
+			if res.err != nil {
+				logger.Warn("service: failed to generate proof", zap.Error(res.err))
+				status.State = StateFailed
+				status.Error = res.err.Error()
+			} else {
+				logger.Info("service: generated proof", zap.Duration("duration", status.Elapsed))
+				status.State = StateDone
+				status.Proof = res.proof
+				status.Metadata = res.metadata
+			}
+			stream.write(status)
+			return
+		case <-r.Context().Done():
+			logger.Info("service: request canceled, the proof is generated in the background and discarded")
+			return
+		}
+	}
+}
+
+// generate is the default proveFunc. It reads the identity of the data directory from its metadata.
+func (s *Server) generate(
+	ctx context.Context,
+	ch shared.Challenge,
+	datadir string,
+) (*shared.Proof, *shared.ProofMetadata, error) {
+	m, err := initialization.LoadMetadata(datadir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := append([]proving.OptionFunc{
+		proving.WithDataSource(s.cfg, m.NodeId, m.CommitmentAtxId, datadir),
+	}, s.provingOpts...)
+	return proving.Generate(ctx, ch, s.cfg, s.logger, opts...)
+}
+
+// statusWriter writes Status messages to a response and flushes them immediately.
+type statusWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+	err     error
+}
+
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	flusher, _ := w.(http.Flusher)
+	return &statusWriter{enc: json.NewEncoder(w), flusher: flusher}
+}
+
+func (sw *statusWriter) write(status Status) {
+	if sw.err != nil {
+		return
+	}
+	if sw.err = sw.enc.Encode(status); sw.err != nil {
+		return
+	}
+	if sw.flusher != nil {
+		sw.flusher.Flush()
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
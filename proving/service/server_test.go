@@ -0,0 +1,316 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+// fakeProver returns a proof for every call once it is released.
+type fakeProver struct {
+	started chan string
+	release chan error
+}
+
+func newFakeProver() *fakeProver {
+	return &fakeProver{
+		started: make(chan string, 10),
+		release: make(chan error),
+	}
+}
+
+func (p *fakeProver) prove(
+	ctx context.Context,
+	ch shared.Challenge,
+	datadir string,
+) (*shared.Proof, *shared.ProofMetadata, error) {
+	p.started <- datadir
+	if err := <-p.release; err != nil {
+		return nil, nil, err
+	}
+	return &shared.Proof{Nonce: 1, Indices: []byte(datadir), Pow: 2}, &shared.ProofMetadata{Challenge: ch}, nil
+}
+
+func testServer(t *testing.T, prover *fakeProver, names ...string) (*Client, map[string]string) {
+	t.Helper()
+
+	datadirs := make(map[string]string)
+	opts := []OptionFunc{
+		WithLogger(zaptest.NewLogger(t)),
+		WithStatusInterval(time.Millisecond),
+		withProveFunc(prover.prove),
+	}
+	for _, name := range names {
+		datadirs[name] = t.TempDir()
+		opts = append(opts, WithDatadir(name, datadirs[name]))
+	}
+	s, err := NewServer(opts...)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(ts.URL, ts.Client())
+	require.NoError(t, err)
+	return client, datadirs
+}
+
+func testChallenge() shared.Challenge {
+	return bytes.Repeat([]byte{0xca}, 32)
+}
+
+func TestServer_Datadirs(t *testing.T) {
+	client, _ := testServer(t, newFakeProver(), "b", "a", "c")
+
+	names, err := client.Datadirs(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, names)
+}
+
+func TestServer_Generate(t *testing.T) {
+	prover := newFakeProver()
+	client, datadirs := testServer(t, prover, "a")
+
+	var mtx sync.Mutex
+	var states []State
+	onStatus := func(s Status) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		states = append(states, s.State)
+	}
+
+	type result struct {
+		proof    *shared.Proof
+		metadata *shared.ProofMetadata
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		proof, metadata, err := client.Generate(context.Background(), "a", testChallenge(), onStatus)
+		done <- result{proof, metadata, err}
+	}()
+
+	require.Equal(t, datadirs["a"], <-prover.started)
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(states) > 1
+	}, time.Second, time.Millisecond)
+	prover.release <- nil
+
+	res := <-done
+	require.NoError(t, res.err)
+	require.Equal(t, &shared.Proof{Nonce: 1, Indices: []byte(datadirs["a"]), Pow: 2}, res.proof)
+	require.Equal(t, testChallenge(), res.metadata.Challenge)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Equal(t, StateAccepted, states[0])
+	require.Equal(t, StateProving, states[1])
+	require.Equal(t, StateDone, states[len(states)-1])
+}
+
+func TestServer_RejectsConcurrentRequestsForDatadir(t *testing.T) {
+	prover := newFakeProver()
+	client, datadirs := testServer(t, prover, "a", "b")
+
+	errs := make(chan error, 2)
+	go func() {
+		_, _, err := client.Generate(context.Background(), "a", testChallenge(), nil)
+		errs <- err
+	}()
+	require.Equal(t, datadirs["a"], <-prover.started)
+
+	// the same datadir is busy
+	_, _, err := client.Generate(context.Background(), "a", testChallenge(), nil)
+	require.ErrorIs(t, err, ErrDatadirBusy)
+
+	// other datadirs are not
+	go func() {
+		_, _, err := client.Generate(context.Background(), "b", testChallenge(), nil)
+		errs <- err
+	}()
+	require.Equal(t, datadirs["b"], <-prover.started)
+
+	prover.release <- nil
+	prover.release <- nil
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	// once the proof was generated the datadir can be used again
+	go func() { prover.release <- nil }()
+	_, _, err = client.Generate(context.Background(), "a", testChallenge(), nil)
+	require.NoError(t, err)
+}
+
+func TestServer_RejectsConcurrentRequestsForSamePath(t *testing.T) {
+	prover := newFakeProver()
+	dir := t.TempDir()
+	s, err := NewServer(
+		WithLogger(zaptest.NewLogger(t)),
+		withProveFunc(prover.prove),
+		WithDatadir("a", dir),
+		WithDatadir("b", filepath.Join(dir, "..", filepath.Base(dir))+"/"),
+	)
+	require.NoError(t, err)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	client, err := NewClient(ts.URL, ts.Client())
+	require.NoError(t, err)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := client.Generate(context.Background(), "a", testChallenge(), nil)
+		errs <- err
+	}()
+	require.Equal(t, dir, <-prover.started)
+
+	// "b" is the same datadir under another name
+	_, _, err = client.Generate(context.Background(), "b", testChallenge(), nil)
+	require.ErrorIs(t, err, ErrDatadirBusy)
+
+	prover.release <- nil
+	require.NoError(t, <-errs)
+}
+
+func TestServer_CanceledRequestKeepsDatadirBusy(t *testing.T) {
+	prover := newFakeProver()
+	client, datadirs := testServer(t, prover, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := client.Generate(ctx, "a", testChallenge(), nil)
+		errs <- err
+	}()
+	require.Equal(t, datadirs["a"], <-prover.started)
+	cancel()
+	require.ErrorIs(t, <-errs, context.Canceled)
+
+	// the proof of the canceled request is still generated
+	_, _, err := client.Generate(context.Background(), "a", testChallenge(), nil)
+	require.ErrorIs(t, err, ErrDatadirBusy)
+
+	prover.release <- nil
+	go func() { prover.release <- nil }()
+	require.Eventually(t, func() bool {
+		_, _, err := client.Generate(context.Background(), "a", testChallenge(), nil)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_GenerateFails(t *testing.T) {
+	prover := newFakeProver()
+	client, _ := testServer(t, prover, "a")
+
+	go func() {
+		<-prover.started
+		prover.release <- errors.New("no luck")
+	}()
+	_, _, err := client.Generate(context.Background(), "a", testChallenge(), nil)
+	require.ErrorContains(t, err, "no luck")
+}
+
+func TestServer_InvalidRequests(t *testing.T) {
+	client, _ := testServer(t, newFakeProver(), "a")
+
+	_, _, err := client.Generate(context.Background(), "unknown", testChallenge(), nil)
+	require.ErrorIs(t, err, ErrDatadirNotFound)
+
+	_, _, err = client.Generate(context.Background(), "a", testChallenge()[:31], nil)
+	require.ErrorContains(t, err, "invalid `Challenge` length")
+
+	resp, err := client.http.Get(client.baseURL + datadirsPath + "/a" + proofSuffix)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = client.http.Post(client.baseURL+datadirsPath+"/a"+proofSuffix, contentTypeJSON, strings.NewReader("{"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestNewServer_InvalidOptions(t *testing.T) {
+	_, err := NewServer()
+	require.ErrorContains(t, err, "at least one datadir is required")
+
+	dir := t.TempDir()
+	_, err = NewServer(WithDatadir("a", dir), WithDatadir("a", dir))
+	require.ErrorContains(t, err, "already added")
+
+	_, err = NewServer(WithDatadir("a", dir+"/missing"))
+	require.Error(t, err)
+
+	_, err = NewServer(WithDatadir("a", dir), WithNonces(0))
+	require.Error(t, err)
+
+	_, err = NewServer(WithDatadir("a", dir), WithStatusInterval(0))
+	require.ErrorContains(t, err, "invalid `statusInterval`")
+
+	_, err = NewClient("localhost:1234", nil)
+	require.Error(t, err)
+}
+
+func TestServer_GenerateFromDatadir(t *testing.T) {
+	r := require.New(t)
+	log := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+
+	cfg := config.DefaultConfig()
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16 // speed up initialization
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderID = new(uint32)
+	*opts.ProviderID = postrs.CPUProviderID()
+	opts.ComputeBatchSize = 1 << 14
+
+	nodeId := bytes.Repeat([]byte{0x01}, 32)
+	commitmentAtxId := bytes.Repeat([]byte{0x02}, 32)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(log),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	s, err := NewServer(
+		WithConfig(cfg),
+		WithLogger(log),
+		WithDatadir("node", opts.DataDir),
+		WithThreads(2),
+		WithPowFlags(config.RecommendedPowFlags()),
+	)
+	r.NoError(err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, ts.Client())
+	r.NoError(err)
+	proof, metadata, err := client.Generate(context.Background(), "node", testChallenge(), nil)
+	r.NoError(err)
+	r.NotNil(proof)
+	r.Equal(nodeId, metadata.NodeId)
+	r.Equal(commitmentAtxId, metadata.CommitmentAtxId)
+	r.Equal(testChallenge(), metadata.Challenge)
+	r.Equal(opts.NumUnits, metadata.NumUnits)
+}
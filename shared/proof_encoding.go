@@ -0,0 +1,237 @@
+package shared
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+)
+
+// ProofEncodingVersion is the version of the binary encoding of Proof and ProofMetadata.
+const ProofEncodingVersion = 1
+
+const (
+	proofHeaderSize    = 1 + 4 + 8 + 4 // version, nonce, pow, length of indices
+	proofMetadataSize  = 1 + 32 + 32 + 32 + 4 + 8
+	proofHashDomainTag = "post proof v1"
+)
+
+var (
+	ErrInvalidProofEncoding       = errors.New("invalid proof encoding")
+	ErrUnsupportedEncodingVersion = errors.New("unsupported encoding version")
+)
+
+// HexBytes is a byte slice that is encoded as a hex string in JSON. It uses the encoding of NonceValue.
+type HexBytes = NonceValue
+
+// ProofIndicesSize returns the size in bytes of the indices of a valid proof for `numLabels` labels.
+func ProofIndicesSize(numLabels uint64, k2 uint) uint {
+	if numLabels == 0 {
+		return 0
+	}
+	return Size(uint(BinaryRepresentationMinBits(numLabels)), k2)
+}
+
+// CheckIndicesSize returns an error if the size of the indices of the proof doesn't match the size expected
+// for a proof of `k2` indices into `numLabels` labels.
+func (p *Proof) CheckIndicesSize(numLabels uint64, k2 uint) error {
+	if expected := ProofIndicesSize(numLabels, k2); uint(len(p.Indices)) != expected {
+		return fmt.Errorf("%w: invalid `Indices` length; expected: %d, given: %d",
+			ErrInvalidProofEncoding, expected, len(p.Indices),
+		)
+	}
+	return nil
+}
+
+// MarshalBinary returns the canonical binary encoding of the proof:
+//
+//	version (1 byte) | nonce (4 bytes LE) | pow (8 bytes LE) | len(indices) (4 bytes LE) | indices
+func (p Proof) MarshalBinary() ([]byte, error) {
+	if uint64(len(p.Indices)) > uint64(^uint32(0)) {
+		return nil, fmt.Errorf("%w: `Indices` too long: %d bytes", ErrInvalidProofEncoding, len(p.Indices))
+	}
+
+	data := make([]byte, proofHeaderSize, proofHeaderSize+len(p.Indices))
+	data[0] = ProofEncodingVersion
+	binary.LittleEndian.PutUint32(data[1:], p.Nonce)
+	binary.LittleEndian.PutUint64(data[5:], p.Pow)
+	binary.LittleEndian.PutUint32(data[13:], uint32(len(p.Indices)))
+	return append(data, p.Indices...), nil
+}
+
+// UnmarshalBinary decodes a proof encoded with MarshalBinary. Only the canonical encoding is accepted.
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	if err := checkVersion(data); err != nil {
+		return err
+	}
+	if len(data) < proofHeaderSize {
+		return fmt.Errorf("%w: expected at least %d bytes, given: %d",
+			ErrInvalidProofEncoding, proofHeaderSize, len(data),
+		)
+	}
+
+	indicesSize := uint64(binary.LittleEndian.Uint32(data[13:]))
+	if uint64(len(data)-proofHeaderSize) != indicesSize {
+		return fmt.Errorf("%w: expected %d bytes of indices, given: %d",
+			ErrInvalidProofEncoding, indicesSize, len(data)-proofHeaderSize,
+		)
+	}
+
+	p.Nonce = binary.LittleEndian.Uint32(data[1:])
+	p.Pow = binary.LittleEndian.Uint64(data[5:])
+	p.Indices = make([]byte, indicesSize)
+	copy(p.Indices, data[proofHeaderSize:])
+	return nil
+}
+
+// DecodeProof decodes a proof encoded with MarshalBinary and checks that its indices have the size expected
+// for a proof of `k2` indices into `numLabels` labels.
+func DecodeProof(data []byte, numLabels uint64, k2 uint) (*Proof, error) {
+	expected := proofHeaderSize + uint64(ProofIndicesSize(numLabels, k2))
+	if uint64(len(data)) != expected {
+		return nil, fmt.Errorf("%w: expected %d bytes, given: %d", ErrInvalidProofEncoding, expected, len(data))
+	}
+
+	p := &Proof{}
+	if err := p.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if err := p.CheckIndicesSize(numLabels, k2); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Hash returns a stable identifier of the proof. It is the blake3 hash of its canonical binary encoding, see
+// MarshalBinary. The fields are hashed directly, so it never fails: the indices are hashed last, which keeps the
+// hash unique even for indices too long for the length field of the encoding.
+func (p *Proof) Hash() [32]byte {
+	var header [proofHeaderSize]byte
+	header[0] = ProofEncodingVersion
+	binary.LittleEndian.PutUint32(header[1:], p.Nonce)
+	binary.LittleEndian.PutUint64(header[5:], p.Pow)
+	binary.LittleEndian.PutUint32(header[13:], uint32(len(p.Indices)))
+
+	var hash [32]byte
+	hh := blake3.New()
+	hh.Write([]byte(proofHashDomainTag))
+	hh.Write(header[:])
+	hh.Write(p.Indices)
+	hh.Sum(hash[:0])
+	return hash
+}
+
+type proofJSON struct {
+	Nonce   uint32
+	Indices HexBytes
+	Pow     uint64
+}
+
+func (p Proof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(proofJSON{
+		Nonce:   p.Nonce,
+		Indices: p.Indices,
+		Pow:     p.Pow,
+	})
+}
+
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	var v proofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	p.Nonce = v.Nonce
+	p.Indices = v.Indices
+	p.Pow = v.Pow
+	return nil
+}
+
+// MarshalBinary returns the canonical binary encoding of the proof metadata:
+//
+//	version (1 byte) | node id (32 bytes) | commitment atx id (32 bytes) | challenge (32 bytes) |
+//	num units (4 bytes LE) | labels per unit (8 bytes LE)
+func (m ProofMetadata) MarshalBinary() ([]byte, error) {
+	for _, field := range []struct {
+		name  string
+		value []byte
+	}{
+		{"NodeId", m.NodeId},
+		{"CommitmentAtxId", m.CommitmentAtxId},
+		{"Challenge", m.Challenge},
+	} {
+		if len(field.value) != 32 {
+			return nil, fmt.Errorf("%w: invalid `%s` length; expected: 32, given: %d",
+				ErrInvalidProofEncoding, field.name, len(field.value),
+			)
+		}
+	}
+
+	data := make([]byte, 0, proofMetadataSize)
+	data = append(data, ProofEncodingVersion)
+	data = append(data, m.NodeId...)
+	data = append(data, m.CommitmentAtxId...)
+	data = append(data, m.Challenge...)
+	data = binary.LittleEndian.AppendUint32(data, m.NumUnits)
+	data = binary.LittleEndian.AppendUint64(data, m.LabelsPerUnit)
+	return data, nil
+}
+
+// UnmarshalBinary decodes proof metadata encoded with MarshalBinary.
+func (m *ProofMetadata) UnmarshalBinary(data []byte) error {
+	if err := checkVersion(data); err != nil {
+		return err
+	}
+	if len(data) != proofMetadataSize {
+		return fmt.Errorf("%w: expected %d bytes, given: %d", ErrInvalidProofEncoding, proofMetadataSize, len(data))
+	}
+
+	m.NodeId = append([]byte(nil), data[1:33]...)
+	m.CommitmentAtxId = append([]byte(nil), data[33:65]...)
+	m.Challenge = append(Challenge(nil), data[65:97]...)
+	m.NumUnits = binary.LittleEndian.Uint32(data[97:])
+	m.LabelsPerUnit = binary.LittleEndian.Uint64(data[101:])
+	return nil
+}
+
+type proofMetadataJSON struct {
+	NodeId          HexBytes
+	CommitmentAtxId HexBytes
+	Challenge       HexBytes
+	NumUnits        uint32
+	LabelsPerUnit   uint64
+}
+
+func (m ProofMetadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(proofMetadataJSON{
+		NodeId:          m.NodeId,
+		CommitmentAtxId: m.CommitmentAtxId,
+		Challenge:       HexBytes(m.Challenge),
+		NumUnits:        m.NumUnits,
+		LabelsPerUnit:   m.LabelsPerUnit,
+	})
+}
+
+func (m *ProofMetadata) UnmarshalJSON(data []byte) error {
+	var v proofMetadataJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.NodeId = v.NodeId
+	m.CommitmentAtxId = v.CommitmentAtxId
+	m.Challenge = Challenge(v.Challenge)
+	m.NumUnits = v.NumUnits
+	m.LabelsPerUnit = v.LabelsPerUnit
+	return nil
+}
+
+func checkVersion(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty", ErrInvalidProofEncoding)
+	}
+	if data[0] != ProofEncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncodingVersion, data[0])
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package shared_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+func testProof(numLabels uint64, k2 uint) *shared.Proof {
+	indices := make([]byte, shared.ProofIndicesSize(numLabels, k2))
+	rand.New(rand.NewSource(1)).Read(indices)
+	return &shared.Proof{
+		Nonce:   7,
+		Indices: indices,
+		Pow:     0x0102030405060708,
+	}
+}
+
+func testProofMetadata() *shared.ProofMetadata {
+	return &shared.ProofMetadata{
+		NodeId:          bytes.Repeat([]byte{0x01}, 32),
+		CommitmentAtxId: bytes.Repeat([]byte{0x02}, 32),
+		Challenge:       bytes.Repeat([]byte{0x03}, 32),
+		NumUnits:        4,
+		LabelsPerUnit:   1 << 32,
+	}
+}
+
+func TestProof_BinaryRoundTrip(t *testing.T) {
+	cfg := config.MainnetConfig()
+	numLabels := 4 * cfg.LabelsPerUnit
+	proof := testProof(numLabels, cfg.K2)
+
+	data, err := proof.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, data, 17+int(shared.ProofIndicesSize(numLabels, cfg.K2)))
+	require.Equal(t, byte(shared.ProofEncodingVersion), data[0])
+
+	var decoded shared.Proof
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, *proof, decoded)
+
+	// the encoding is canonical
+	encoded, err := decoded.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	p, err := shared.DecodeProof(data, numLabels, cfg.K2)
+	require.NoError(t, err)
+	require.Equal(t, proof, p)
+}
+
+func TestProof_BinaryInvalid(t *testing.T) {
+	cfg := config.MainnetConfig()
+	numLabels := 4 * cfg.LabelsPerUnit
+	data, err := testProof(numLabels, cfg.K2).MarshalBinary()
+	require.NoError(t, err)
+
+	var p shared.Proof
+	require.ErrorIs(t, p.UnmarshalBinary(nil), shared.ErrInvalidProofEncoding)
+	require.ErrorIs(t, p.UnmarshalBinary(data[:10]), shared.ErrInvalidProofEncoding)
+	require.ErrorIs(t, p.UnmarshalBinary(data[:len(data)-1]), shared.ErrInvalidProofEncoding)
+	require.ErrorIs(t, p.UnmarshalBinary(append(data, 0)), shared.ErrInvalidProofEncoding)
+
+	unsupported := append([]byte{}, data...)
+	unsupported[0] = shared.ProofEncodingVersion + 1
+	require.ErrorIs(t, p.UnmarshalBinary(unsupported), shared.ErrUnsupportedEncodingVersion)
+
+	// the size of the indices is checked against the expected size
+	_, err = shared.DecodeProof(data, numLabels, cfg.K2+1)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+	_, err = shared.DecodeProof(data, numLabels*4, cfg.K2)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+}
+
+func TestProof_CheckIndicesSize(t *testing.T) {
+	for _, tc := range []struct {
+		numLabels uint64
+		k2        uint
+		size      uint
+	}{
+		{numLabels: 0, k2: 1, size: 0},
+		{numLabels: 1, k2: 1, size: 1},
+		{numLabels: 255, k2: 8, size: 8},
+		{numLabels: 256, k2: 8, size: 9},
+		{numLabels: 4 << 32, k2: 37, size: 162},
+	} {
+		require.Equal(t, tc.size, shared.ProofIndicesSize(tc.numLabels, tc.k2))
+
+		proof := &shared.Proof{Indices: make([]byte, tc.size)}
+		require.NoError(t, proof.CheckIndicesSize(tc.numLabels, tc.k2))
+		proof.Indices = append(proof.Indices, 0)
+		require.ErrorIs(t, proof.CheckIndicesSize(tc.numLabels, tc.k2), shared.ErrInvalidProofEncoding)
+	}
+}
+
+func TestProof_JSONRoundTrip(t *testing.T) {
+	proof := &shared.Proof{Nonce: 7, Indices: []byte{0xde, 0xad, 0xbe, 0xef}, Pow: 42}
+
+	data, err := json.Marshal(proof)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Nonce":7,"Indices":"deadbeef","Pow":42}`, string(data))
+
+	var decoded shared.Proof
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *proof, decoded)
+
+	require.Error(t, json.Unmarshal([]byte(`{"Indices":"not hex"}`), &decoded))
+}
+
+func TestProof_Hash(t *testing.T) {
+	cfg := config.MainnetConfig()
+	proof := testProof(4*cfg.LabelsPerUnit, cfg.K2)
+
+	hash := proof.Hash()
+	require.Equal(t, hash, proof.Hash())
+
+	// the hash of a copy is the same
+	clone := *proof
+	clone.Indices = append([]byte{}, proof.Indices...)
+	require.Equal(t, hash, clone.Hash())
+
+	// every field changes the hash
+	clone.Nonce++
+	require.NotEqual(t, hash, clone.Hash())
+	clone = *proof
+	clone.Pow++
+	require.NotEqual(t, hash, clone.Hash())
+	clone = *proof
+	clone.Indices = append([]byte{}, proof.Indices...)
+	clone.Indices[0] ^= 1
+	require.NotEqual(t, hash, clone.Hash())
+
+	// the hash must not change between releases
+	fixed := &shared.Proof{Nonce: 1, Indices: []byte{0x01, 0x02, 0x03}, Pow: 2}
+	hash = fixed.Hash()
+	require.Equal(t, "618abb7c13183f8f1647418d088e8aa40d4adc340c264fd9148d0e4724bbbd77", hex.EncodeToString(hash[:]))
+}
+
+func TestProofMetadata_BinaryRoundTrip(t *testing.T) {
+	metadata := testProofMetadata()
+
+	data, err := metadata.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, data, 109)
+
+	var decoded shared.ProofMetadata
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, *metadata, decoded)
+
+	encoded, err := decoded.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	require.ErrorIs(t, decoded.UnmarshalBinary(data[:len(data)-1]), shared.ErrInvalidProofEncoding)
+	require.ErrorIs(t, decoded.UnmarshalBinary(append(data, 0)), shared.ErrInvalidProofEncoding)
+	data[0] = 0
+	require.ErrorIs(t, decoded.UnmarshalBinary(data), shared.ErrUnsupportedEncodingVersion)
+}
+
+func TestProofMetadata_BinaryInvalidFields(t *testing.T) {
+	metadata := testProofMetadata()
+	metadata.NodeId = metadata.NodeId[:31]
+	_, err := metadata.MarshalBinary()
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+	require.ErrorContains(t, err, "NodeId")
+
+	metadata = testProofMetadata()
+	metadata.Challenge = nil
+	_, err = metadata.MarshalBinary()
+	require.ErrorContains(t, err, "Challenge")
+}
+
+func TestProofMetadata_JSONRoundTrip(t *testing.T) {
+	metadata := testProofMetadata()
+
+	data, err := json.Marshal(metadata)
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(data, &fields))
+	require.Equal(t, hex.EncodeToString(metadata.NodeId), fields["NodeId"])
+	require.Equal(t, hex.EncodeToString(metadata.CommitmentAtxId), fields["CommitmentAtxId"])
+	require.Equal(t, hex.EncodeToString(metadata.Challenge), fields["Challenge"])
+
+	var decoded shared.ProofMetadata
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *metadata, decoded)
+}
@@ -0,0 +1,84 @@
+package shared
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// DecodeIndices decodes the `k2` indices of a proof for `numLabels` labels.
+//
+// The indices are packed with BinaryRepresentationMinBits(numLabels) bits each, in the same order as post-rs: the
+// first index starts at the least significant bit of the first byte and every index is stored least significant
+// bit first.
+// The unused bits of the last byte must be zero.
+//
+// Indices are not checked against `numLabels`, a corrupt proof might contain indices >= `numLabels`.
+func DecodeIndices(indices []byte, numLabels uint64, k2 uint) ([]uint64, error) {
+	if numLabels == 0 {
+		return nil, fmt.Errorf("%w: `numLabels` must be greater than 0", ErrInvalidProofEncoding)
+	}
+	bitSize := uint(BinaryRepresentationMinBits(numLabels))
+	if expected := Size(bitSize, k2); uint(len(indices)) != expected {
+		return nil, fmt.Errorf("%w: invalid `Indices` length; expected: %d, given: %d",
+			ErrInvalidProofEncoding, expected, len(indices),
+		)
+	}
+
+	decoded := make([]uint64, k2)
+	offset := uint(0)
+	for i := range decoded {
+		decoded[i] = readBits(indices, offset, bitSize)
+		offset += bitSize
+	}
+
+	if trailing := uint(len(indices))*8 - offset; trailing > 0 && readBits(indices, offset, trailing) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bits of `Indices` are not zero", ErrInvalidProofEncoding, trailing)
+	}
+	return decoded, nil
+}
+
+// EncodeIndices packs `indices` into a proof for `numLabels` labels. It is the inverse of DecodeIndices.
+func EncodeIndices(indices []uint64, numLabels uint64) ([]byte, error) {
+	if numLabels == 0 {
+		return nil, fmt.Errorf("%w: `numLabels` must be greater than 0", ErrInvalidProofEncoding)
+	}
+	bitSize := uint(BinaryRepresentationMinBits(numLabels))
+
+	encoded := make([]byte, Size(bitSize, uint(len(indices))))
+	offset := uint(0)
+	for i, index := range indices {
+		if uint(bits.Len64(index)) > bitSize {
+			return nil, fmt.Errorf("%w: index %d (%d) doesn't fit into %d bits",
+				ErrInvalidProofEncoding, i, index, bitSize,
+			)
+		}
+		writeBits(encoded, offset, bitSize, index)
+		offset += bitSize
+	}
+	return encoded, nil
+}
+
+// readBits reads `n` <= 64 bits starting at bit `offset` of `b`, least significant bit first.
+func readBits(b []byte, offset, n uint) uint64 {
+	var v uint64
+	for read := uint(0); read < n; {
+		shift := (offset + read) % 8
+		count := min(8-shift, n-read)
+		chunk := uint64(b[(offset+read)/8]>>shift) & (1<<count - 1)
+		v |= chunk << read
+		read += count
+	}
+	return v
+}
+
+// writeBits writes the `n` <= 64 least significant bits of `v` starting at bit `offset` of `b`.
+// The bits in `b` must be zero.
+func writeBits(b []byte, offset, n uint, v uint64) {
+	for written := uint(0); written < n; {
+		shift := (offset + written) % 8
+		count := min(8-shift, n-written)
+		chunk := (v >> written) & (1<<count - 1)
+		b[(offset+written)/8] |= byte(chunk << shift)
+		written += count
+	}
+}
@@ -0,0 +1,77 @@
+package shared_test
+
+import (
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestDecodeIndices_BitOrder(t *testing.T) {
+	// 3 indices of 2 bits each (numLabels = 3), packed least significant bit first:
+	// 0b00_11_10_01
+	indices, err := shared.DecodeIndices([]byte{0x39}, 3, 3)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3}, indices)
+
+	// indices crossing byte boundaries (numLabels = 1000, 10 bits each)
+	encoded, err := shared.EncodeIndices([]uint64{0x3ff, 0x001, 0x2aa}, 1000)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xff, 0x07, 0xa0, 0x2a}, encoded)
+}
+
+func TestDecodeIndices_RoundTrip(t *testing.T) {
+	roundTrip := func(numLabels uint64, k2 uint8, seed int64) bool {
+		numLabels = max(numLabels>>(seed&63), 1)
+		rng := rand.New(rand.NewSource(seed))
+		indices := make([]uint64, k2)
+		for i := range indices {
+			indices[i] = rng.Uint64() % numLabels
+		}
+
+		encoded, err := shared.EncodeIndices(indices, numLabels)
+		if err != nil || uint(len(encoded)) != shared.ProofIndicesSize(numLabels, uint(k2)) {
+			return false
+		}
+		decoded, err := shared.DecodeIndices(encoded, numLabels, uint(k2))
+		if err != nil || len(decoded) != len(indices) {
+			return false
+		}
+		for i := range indices {
+			if decoded[i] != indices[i] {
+				return false
+			}
+		}
+		return true
+	}
+	require.NoError(t, quick.Check(roundTrip, &quick.Config{MaxCount: 1000}))
+}
+
+func TestDecodeIndices_Invalid(t *testing.T) {
+	// 3 indices of 2 bits each leave 2 unused bits in the last byte
+	for _, trailing := range []byte{0x40, 0x80} {
+		_, err := shared.DecodeIndices([]byte{0x39 | trailing}, 3, 3)
+		require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+		require.ErrorContains(t, err, "trailing bits")
+	}
+
+	_, err := shared.DecodeIndices([]byte{0x39, 0x00}, 3, 3)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+	_, err = shared.DecodeIndices([]byte{0x39}, 3, 5)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+	_, err = shared.DecodeIndices([]byte{0x39}, 0, 3)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+
+	_, err = shared.EncodeIndices([]uint64{4}, 3)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+	_, err = shared.EncodeIndices([]uint64{1}, 0)
+	require.ErrorIs(t, err, shared.ErrInvalidProofEncoding)
+
+	// indices >= numLabels that fit into the bit size are decoded
+	indices, err := shared.DecodeIndices([]byte{0x03}, 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3}, indices)
+}
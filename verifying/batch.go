@@ -0,0 +1,223 @@
+package verifying
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+// VerifyRequest is a proof to verify with a BatchVerifier.
+type VerifyRequest struct {
+	Proof    *shared.Proof
+	Metadata *shared.ProofMetadata
+	// Opts are passed to ProofVerifier.Verify for this proof.
+	Opts []OptionFunc
+}
+
+// VerifyResult is the result of verifying a VerifyRequest.
+type VerifyResult struct {
+	// Seq is the position of the request in the stream of requests, starting at 0.
+	Seq     int
+	Request VerifyRequest
+	// Err is nil if the proof is valid.
+	Err error
+}
+
+type batchOption struct {
+	workers   int
+	unordered bool
+	logger    *zap.Logger
+}
+
+type BatchOptionFunc func(*batchOption)
+
+// WithWorkers sets the number of proofs that are verified at the same time. Defaults to the number of CPUs.
+func WithWorkers(workers int) BatchOptionFunc {
+	return func(o *batchOption) {
+		o.workers = workers
+	}
+}
+
+// WithUnorderedResults returns the results as soon as the proofs are verified instead of in the order of the
+// requests.
+func WithUnorderedResults() BatchOptionFunc {
+	return func(o *batchOption) {
+		o.unordered = true
+	}
+}
+
+func WithBatchLogger(logger *zap.Logger) BatchOptionFunc {
+	return func(o *batchOption) {
+		o.logger = logger
+	}
+}
+
+// BatchVerifier verifies a stream of proofs concurrently with a fixed number of workers. All workers share the
+// same ProofVerifier.
+type BatchVerifier struct {
+	verifier *ProofVerifier
+	cfg      config.Config
+	options  batchOption
+
+	// verify is verifier.Verify, replaced in tests.
+	verify func(*shared.Proof, *shared.ProofMetadata, config.Config, *zap.Logger, ...OptionFunc) error
+}
+
+// NewBatchVerifier creates a new BatchVerifier that verifies proofs for `cfg` with `verifier`.
+// The verifier isn't closed by the BatchVerifier and must stay open while it is used.
+func NewBatchVerifier(verifier *ProofVerifier, cfg config.Config, opts ...BatchOptionFunc) (*BatchVerifier, error) {
+	if verifier == nil {
+		return nil, errors.New("verifier is nil")
+	}
+	options := batchOption{
+		workers: runtime.NumCPU(),
+		logger:  zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.workers < 1 {
+		return nil, fmt.Errorf("invalid `workers`; expected: >= 1, given: %d", options.workers)
+	}
+	if options.logger == nil {
+		return nil, errors.New("logger is nil")
+	}
+
+	return &BatchVerifier{
+		verifier: verifier,
+		cfg:      cfg,
+		options:  options,
+		verify:   verifier.Verify,
+	}, nil
+}
+
+type batchJob struct {
+	seq     int
+	request VerifyRequest
+	// out receives the result in ordered mode.
+	out chan VerifyResult
+}
+
+// Verify verifies the proofs received from `requests` until it is closed and sends a result for every request to
+// the returned channel, which is closed afterwards. New requests are only accepted while the number of requests
+// that are verified or waiting to be read from the returned channel is below the number of workers, so the
+// caller must read the results while sending requests.
+//
+// When `ctx` is canceled no more requests are accepted, pending results are dropped and the returned channel is
+// closed. Proofs that are verified at that moment are finished in the background.
+func (b *BatchVerifier) Verify(ctx context.Context, requests <-chan VerifyRequest) <-chan VerifyResult {
+	results := make(chan VerifyResult)
+	jobs := make(chan batchJob)
+
+	// in ordered mode the result of every request is queued here in request order
+	var pending chan chan VerifyResult
+	if !b.options.unordered {
+		pending = make(chan chan VerifyResult, b.options.workers)
+	}
+
+	go func() {
+		defer close(jobs)
+		if pending != nil {
+			defer close(pending)
+		}
+		for seq := 0; ; seq++ {
+			var request VerifyRequest
+			select {
+			case <-ctx.Done():
+				return
+			case r, ok := <-requests:
+				if !ok {
+					return
+				}
+				request = r
+			}
+
+			job := batchJob{seq: seq, request: request}
+			if pending != nil {
+				job.out = make(chan VerifyResult, 1)
+				select {
+				case pending <- job.out:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < b.options.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.work(ctx, jobs, results)
+		}()
+	}
+
+	if pending == nil {
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		return results
+	}
+
+	go func() {
+		defer close(results)
+		for out := range pending {
+			select {
+			case result := <-out:
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
+
+func (b *BatchVerifier) work(ctx context.Context, jobs <-chan batchJob, results chan<- VerifyResult) {
+	for job := range jobs {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		result := VerifyResult{Seq: job.seq, Request: job.request}
+		switch {
+		case job.request.Proof == nil:
+			result.Err = errors.New("proof is nil")
+		case job.request.Metadata == nil:
+			result.Err = errors.New("metadata is nil")
+		default:
+			result.Err = b.verify(job.request.Proof, job.request.Metadata, b.cfg, b.options.logger, job.request.Opts...)
+		}
+		if result.Err != nil {
+			b.options.logger.Debug("verifying: invalid proof", zap.Int("seq", job.seq), zap.Error(result.Err))
+		}
+
+		if job.out != nil {
+			// buffered, never blocks
+			job.out <- result
+			continue
+		}
+		select {
+		case results <- result:
+		case <-ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package verifying
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+var errOddNonce = errors.New("odd nonce")
+
+// fakeVerify rejects proofs with an odd nonce. Proofs with a lower nonce take longer to verify.
+type fakeVerify struct {
+	running atomic.Int32
+	max     atomic.Int32
+	block   chan struct{}
+}
+
+func (f *fakeVerify) verify(
+	p *shared.Proof,
+	_ *shared.ProofMetadata,
+	_ config.Config,
+	_ *zap.Logger,
+	_ ...OptionFunc,
+) error {
+	running := f.running.Add(1)
+	defer f.running.Add(-1)
+	for {
+		maxRunning := f.max.Load()
+		if running <= maxRunning || f.max.CompareAndSwap(maxRunning, running) {
+			break
+		}
+	}
+	if f.block != nil {
+		<-f.block
+	}
+	time.Sleep(time.Duration(20-min(p.Nonce, 20)) * time.Millisecond)
+	if p.Nonce%2 == 1 {
+		return errOddNonce
+	}
+	return nil
+}
+
+func newTestBatchVerifier(t *testing.T, opts ...BatchOptionFunc) (*BatchVerifier, *fakeVerify) {
+	verifier, err := NewProofVerifier()
+	require.NoError(t, err)
+	t.Cleanup(func() { verifier.Close() })
+
+	cfg, _ := getTestConfig(t)
+	opts = append([]BatchOptionFunc{WithBatchLogger(zaptest.NewLogger(t))}, opts...)
+	bv, err := NewBatchVerifier(verifier, cfg, opts...)
+	require.NoError(t, err)
+
+	fake := &fakeVerify{}
+	bv.verify = fake.verify
+	return bv, fake
+}
+
+func sendRequests(ctx context.Context, n int) (<-chan VerifyRequest, *atomic.Int32) {
+	requests := make(chan VerifyRequest)
+	var sent atomic.Int32
+	go func() {
+		defer close(requests)
+		for i := 0; i < n; i++ {
+			select {
+			case requests <- VerifyRequest{Proof: &shared.Proof{Nonce: uint32(i)}, Metadata: &shared.ProofMetadata{}}:
+				sent.Add(1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return requests, &sent
+}
+
+func TestBatchVerifier_Ordered(t *testing.T) {
+	bv, fake := newTestBatchVerifier(t, WithWorkers(4))
+
+	requests, _ := sendRequests(context.Background(), 20)
+	seq := 0
+	for result := range bv.Verify(context.Background(), requests) {
+		require.Equal(t, seq, result.Seq)
+		require.EqualValues(t, seq, result.Request.Proof.Nonce)
+		if seq%2 == 1 {
+			require.ErrorIs(t, result.Err, errOddNonce)
+		} else {
+			require.NoError(t, result.Err)
+		}
+		seq++
+	}
+	require.Equal(t, 20, seq)
+	require.EqualValues(t, 4, fake.max.Load())
+}
+
+func TestBatchVerifier_Unordered(t *testing.T) {
+	bv, fake := newTestBatchVerifier(t, WithWorkers(3), WithUnorderedResults())
+
+	requests, _ := sendRequests(context.Background(), 20)
+	seen := make(map[int]struct{})
+	for result := range bv.Verify(context.Background(), requests) {
+		require.EqualValues(t, result.Seq, result.Request.Proof.Nonce)
+		if result.Seq%2 == 1 {
+			require.ErrorIs(t, result.Err, errOddNonce)
+		} else {
+			require.NoError(t, result.Err)
+		}
+		seen[result.Seq] = struct{}{}
+	}
+	require.Len(t, seen, 20)
+	require.EqualValues(t, 3, fake.max.Load())
+}
+
+func TestBatchVerifier_Backpressure(t *testing.T) {
+	for _, opts := range [][]BatchOptionFunc{
+		{WithWorkers(2)},
+		{WithWorkers(2), WithUnorderedResults()},
+	} {
+		bv, _ := newTestBatchVerifier(t, opts...)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		requests, sent := sendRequests(ctx, 100)
+		results := bv.Verify(ctx, requests)
+
+		// without reading results only a few requests are accepted
+		time.Sleep(200 * time.Millisecond)
+		require.LessOrEqual(t, sent.Load(), int32(2*2+1))
+
+		// reading the results lets the verifier continue
+		n := 0
+		for range results {
+			n++
+		}
+		require.Equal(t, 100, n)
+		require.EqualValues(t, 100, sent.Load())
+		cancel()
+	}
+}
+
+func TestBatchVerifier_Canceled(t *testing.T) {
+	bv, fake := newTestBatchVerifier(t, WithWorkers(2))
+	fake.block = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	requests, _ := sendRequests(ctx, 100)
+	results := bv.Verify(ctx, requests)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	received := 0
+	go func() {
+		defer wg.Done()
+		for range results {
+			received++
+		}
+	}()
+
+	cancel()
+	close(fake.block)
+	wg.Wait()
+	require.Less(t, received, 100)
+}
+
+func TestBatchVerifier_InvalidProofs(t *testing.T) {
+	verifier, err := NewProofVerifier()
+	require.NoError(t, err)
+	defer verifier.Close()
+
+	cfg, _ := getTestConfig(t)
+	bv, err := NewBatchVerifier(verifier, cfg, WithWorkers(2))
+	require.NoError(t, err)
+
+	requests := make(chan VerifyRequest, 4)
+	metadata := &shared.ProofMetadata{
+		NodeId:          make([]byte, 32),
+		CommitmentAtxId: make([]byte, 32),
+		Challenge:       make([]byte, 32),
+		NumUnits:        1,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	requests <- VerifyRequest{Proof: &shared.Proof{Indices: []byte{1, 2, 3}}, Metadata: metadata}
+	requests <- VerifyRequest{Proof: &shared.Proof{}, Metadata: metadata, Opts: []OptionFunc{AllIndices()}}
+	requests <- VerifyRequest{Metadata: metadata}
+	requests <- VerifyRequest{Proof: &shared.Proof{}}
+	close(requests)
+
+	n := 0
+	for result := range bv.Verify(context.Background(), requests) {
+		require.Error(t, result.Err)
+		n++
+	}
+	require.Equal(t, 4, n)
+}
+
+func TestNewBatchVerifier_Invalid(t *testing.T) {
+	cfg, _ := getTestConfig(t)
+	_, err := NewBatchVerifier(nil, cfg)
+	require.ErrorContains(t, err, "verifier is nil")
+
+	verifier, err := NewProofVerifier()
+	require.NoError(t, err)
+	defer verifier.Close()
+	_, err = NewBatchVerifier(verifier, cfg, WithWorkers(0))
+	require.ErrorContains(t, err, "invalid `workers`")
+	_, err = NewBatchVerifier(verifier, cfg, WithBatchLogger(nil))
+	require.ErrorContains(t, err, "logger is nil")
+}
@@ -0,0 +1,257 @@
+package verifying
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+// StoredLabel is the label stored in a data directory for one index of a proof.
+type StoredLabel struct {
+	Index     uint64
+	FileIndex int
+	// Offset is the offset of the label in bytes in its file.
+	Offset   uint64
+	Stored   shared.HexBytes
+	Expected shared.HexBytes
+	// Err is set if the stored label couldn't be read. It wraps persistence.ErrLabelMissing if the file of the
+	// label is missing or too short.
+	Err error
+}
+
+// Match returns whether the stored label is the expected label.
+func (l *StoredLabel) Match() bool {
+	return l.Err == nil && bytes.Equal(l.Stored, l.Expected)
+}
+
+// StoredLabels is the result of ReadStoredLabels.
+type StoredLabels struct {
+	NumLabels     uint64
+	LabelsPerFile uint64
+	// Labels are the labels of the indices of the proof in the order of the proof.
+	Labels []StoredLabel
+}
+
+// ReadStoredLabels maps the indices of `proof` to the labels stored in `datadir` and compares them with the labels
+// recomputed on the CPU with `scrypt`, the params the data was initialized with. Labels that don't match are
+// logged.
+func ReadStoredLabels(
+	ctx context.Context,
+	proof *shared.Proof,
+	metadata *shared.ProofMetadata,
+	cfg config.Config,
+	datadir string,
+	scrypt config.ScryptParams,
+	logger *zap.Logger,
+) (*StoredLabels, error) {
+	m, err := persistence.LoadMetadata(datadir)
+	if err != nil {
+		return nil, err
+	}
+	err = persistence.VerifyMetadata(m, datadir, metadata.NodeId, metadata.CommitmentAtxId, metadata.LabelsPerUnit)
+	if err != nil {
+		return nil, err
+	}
+	if m.NumUnits < metadata.NumUnits {
+		return nil, shared.ConfigMismatchError{
+			Param:    "NumUnits",
+			Expected: fmt.Sprintf(">= %d", metadata.NumUnits),
+			Found:    strconv.FormatUint(uint64(m.NumUnits), 10),
+			DataDir:  datadir,
+		}
+	}
+	labelsPerFile := m.MaxFileSize / uint64(config.BytesPerLabel())
+	if labelsPerFile == 0 {
+		return nil, fmt.Errorf("invalid `MaxFileSize` in metadata; expected: >= %d, given: %d",
+			config.BytesPerLabel(), m.MaxFileSize,
+		)
+	}
+
+	numLabels := uint64(metadata.NumUnits) * metadata.LabelsPerUnit
+	indices, err := shared.DecodeIndices(proof.Indices, numLabels, cfg.K2)
+	if err != nil {
+		return nil, fmt.Errorf("decoding indices: %w", err)
+	}
+
+	cpuProviderID := postrs.CPUProviderID()
+	wo, err := oracle.New(
+		oracle.WithProviderID(&cpuProviderID),
+		oracle.WithCommitment(oracle.CommitmentBytes(metadata.NodeId, metadata.CommitmentAtxId)),
+		oracle.WithVRFDifficulty(make([]byte, 32)),
+		oracle.WithScryptParams(scrypt),
+		oracle.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer wo.Close()
+
+	reader, err := persistence.NewLabelReader(datadir, labelsPerFile, config.BitsPerLabel)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	labels := &StoredLabels{
+		NumLabels:     numLabels,
+		LabelsPerFile: labelsPerFile,
+		Labels:        make([]StoredLabel, 0, len(indices)),
+	}
+	for _, index := range indices {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		l := StoredLabel{Index: index}
+		l.FileIndex, l.Offset = reader.Position(index)
+		res, err := wo.Position(index)
+		if err != nil {
+			return nil, fmt.Errorf("computing label %d: %w", index, err)
+		}
+		l.Expected = res.Output
+		l.Stored, l.Err = reader.ReadLabel(index)
+		if !l.Match() {
+			logger.Warn("stored label doesn't match",
+				zap.Uint64("index", index),
+				zap.String("file", shared.InitFileName(l.FileIndex)),
+				zap.Uint64("offset", l.Offset),
+				zap.String("stored", hex.EncodeToString(l.Stored)),
+				zap.String("expected", hex.EncodeToString(l.Expected)),
+				zap.NamedError("reason", l.Err),
+			)
+		}
+		labels.Labels = append(labels.Labels, l)
+	}
+	return labels, nil
+}
+
+// DataStatus is the state of the stored label for an index of a proof.
+type DataStatus int
+
+const (
+	// DataHealthy means the stored label equals the recomputed label.
+	DataHealthy DataStatus = iota
+	// DataCorrupt means the stored label differs from the recomputed label.
+	DataCorrupt
+	// DataMissing means the label isn't stored, because its file is missing or too short.
+	DataMissing
+)
+
+func (s DataStatus) String() string {
+	switch s {
+	case DataHealthy:
+		return "healthy"
+	case DataCorrupt:
+		return "corrupt"
+	case DataMissing:
+		return "missing"
+	default:
+		return "unknown"
+	}
+}
+
+// IndexData is the result of checking the stored label for one index of a proof.
+type IndexData struct {
+	StoredLabel
+	// Ordinal is the position of the index in the proof.
+	Ordinal int
+	Status  DataStatus
+	// Candidate is whether the recomputed label satisfies the K1 candidate condition of the proof, i.e. libpost
+	// accepted the index when it was verified on its own.
+	Candidate bool
+	// CandidateErr explains why the index isn't a candidate. It's nil if the condition couldn't be checked
+	// because the proof is invalid for another reason, see DataReport.ProofErr.
+	CandidateErr error
+}
+
+// DataReport is the result of VerifyAgainstData.
+type DataReport struct {
+	Indices []IndexData
+	// ProofErr is set if the proof is invalid for a reason other than its indices, e.g. its PoW. The K1 candidate
+	// condition couldn't be checked for any index in that case.
+	ProofErr error
+}
+
+// Healthy returns whether every label the proof refers to is stored correctly.
+func (r *DataReport) Healthy() bool {
+	for _, index := range r.Indices {
+		if index.Status != DataHealthy {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyAgainstData checks whether `datadir` still holds the labels `proof` relies on. For every index of the
+// proof it reads the stored label and compares it with the label recomputed on the CPU, see ReadStoredLabels.
+// Every index is also verified on its own with libpost to check that its label satisfies the K1 candidate
+// condition.
+//
+// The labels must have been initialized with the scrypt params set with WithLabelScryptParams.
+func VerifyAgainstData(
+	ctx context.Context,
+	proof *shared.Proof,
+	metadata *shared.ProofMetadata,
+	cfg config.Config,
+	datadir string,
+	logger *zap.Logger,
+	opts ...OptionFunc,
+) (*DataReport, error) {
+	options := applyOpts(opts...)
+	labels, err := ReadStoredLabels(ctx, proof, metadata, cfg, datadir, options.labelScrypt, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := NewProofVerifier(WithPowFlags(options.powFlags))
+	if err != nil {
+		return nil, err
+	}
+	defer verifier.Close()
+
+	report := &DataReport{Indices: make([]IndexData, 0, len(labels.Labels))}
+	for ordinal, label := range labels.Labels {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		data := IndexData{StoredLabel: label, Ordinal: ordinal}
+		switch {
+		case errors.Is(data.Err, persistence.ErrLabelMissing):
+			data.Status = DataMissing
+		case data.Err != nil:
+			return nil, fmt.Errorf("reading label %d: %w", data.Index, data.Err)
+		case !data.Match():
+			data.Status = DataCorrupt
+		}
+
+		// an error that isn't about the index is the same for every index, so it's only checked once
+		if report.ProofErr == nil {
+			err := verifier.Verify(proof, metadata, cfg, logger, WithLabelScryptParams(options.labelScrypt),
+				SelectedIndex(ordinal),
+			)
+			switch {
+			case err == nil:
+				data.Candidate = true
+			case errors.Is(err, ErrLabelRejected), errors.Is(err, ErrIndexOutOfRange):
+				data.CandidateErr = err
+				logger.Warn("verifying: index is not a K1 candidate", zap.Int("ordinal", ordinal), zap.Error(err))
+			default:
+				report.ProofErr = err
+			}
+		}
+		report.Indices = append(report.Indices, data)
+	}
+	return report, nil
+}
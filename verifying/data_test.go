@@ -0,0 +1,119 @@
+package verifying
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestVerifyAgainstData(t *testing.T) {
+	r := require.New(t)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	cfg, opts := getTestConfig(t)
+	opts.NumUnits = 2
+	opts.MaxFileSize = 256 * uint64(config.BytesPerLabel()) // 4 files
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(logger),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	// one index in each of the files 0, 1 and 2
+	numLabels := uint64(opts.NumUnits) * cfg.LabelsPerUnit
+	indices := []uint64{97, 300, 600}
+	r.Len(indices, int(cfg.K2))
+	encoded, err := shared.EncodeIndices(indices, numLabels)
+	r.NoError(err)
+	proof := &shared.Proof{Indices: encoded}
+	metadata := &shared.ProofMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		Challenge:       shared.ZeroChallenge,
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	verify := func() *DataReport {
+		report, err := VerifyAgainstData(context.Background(), proof, metadata, cfg, opts.DataDir, logger,
+			WithLabelScryptParams(opts.Scrypt),
+		)
+		r.NoError(err)
+		r.Len(report.Indices, len(indices))
+		return report
+	}
+
+	report := verify()
+	r.True(report.Healthy())
+	// the proof wasn't generated, so its PoW is invalid and the K1 threshold can't be checked
+	r.Error(report.ProofErr)
+	for i, index := range report.Indices {
+		r.Equal(i, index.Ordinal)
+		r.Equal(indices[i], index.Index)
+		r.Equal(i, index.FileIndex)
+		r.Equal(indices[i]%256*uint64(config.BytesPerLabel()), index.Offset)
+		r.Equal(DataHealthy, index.Status)
+		r.Equal(index.Expected, index.Stored)
+		r.False(index.Candidate)
+		r.NoError(index.CandidateErr)
+	}
+
+	// corrupt the label of index 97 (file 0) and remove file 2
+	f, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), os.O_WRONLY, 0)
+	r.NoError(err)
+	_, err = f.WriteAt(make([]byte, config.BytesPerLabel()), 97*int64(config.BytesPerLabel()))
+	r.NoError(err)
+	r.NoError(f.Close())
+	r.NoError(os.Remove(filepath.Join(opts.DataDir, shared.InitFileName(2))))
+
+	report = verify()
+	r.False(report.Healthy())
+	r.Equal(DataCorrupt, report.Indices[0].Status)
+	r.Equal(shared.HexBytes(make([]byte, config.BytesPerLabel())), report.Indices[0].Stored)
+	r.NotEqual(report.Indices[0].Expected, report.Indices[0].Stored)
+	r.Equal(DataHealthy, report.Indices[1].Status)
+	r.Equal(DataMissing, report.Indices[2].Status)
+	r.Nil(report.Indices[2].Stored)
+	r.NotNil(report.Indices[2].Expected)
+	r.ErrorContains(report.Indices[2].Err, "is missing")
+}
+
+func TestVerifyAgainstData_OtherIdentity(t *testing.T) {
+	cfg, opts := getTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(make([]byte, 32)),
+		initialization.WithCommitmentAtxId(make([]byte, 32)),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+
+	nodeId := make([]byte, 32)
+	nodeId[0] = 1
+	metadata := &shared.ProofMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: make([]byte, 32),
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}
+	_, err = VerifyAgainstData(context.Background(), &shared.Proof{}, metadata, cfg, opts.DataDir, zap.NewNop())
+	var errMismatch shared.ConfigMismatchError
+	require.ErrorAs(t, err, &errMismatch)
+	require.Equal(t, "NodeId", errMismatch.Param)
+}
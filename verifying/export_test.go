@@ -0,0 +1,4 @@
+package verifying
+
+// GetTestConfig is getTestConfig for the tests in package verifying_test.
+var GetTestConfig = getTestConfig
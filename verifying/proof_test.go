@@ -0,0 +1,322 @@
+package verifying_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/proving"
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+var _ proving.Verifier = (*verifying.ProofVerifier)(nil)
+
+func Test_Verify(t *testing.T) {
+	r := require.New(t)
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	ch := make(shared.Challenge, 32)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	cfg, opts := verifying.GetTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(logger),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	proof, proofMetadata, err := proving.Generate(
+		context.Background(),
+		ch,
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		proving.LightMode(),
+	)
+	r.NoError(err)
+
+	verifier, err := verifying.NewProofVerifier()
+	r.NoError(err)
+	defer verifier.Close()
+
+	r.NoError(verifier.Verify(proof, proofMetadata, cfg, logger))
+}
+
+func Test_Verify_NoRace_On_Close(t *testing.T) {
+	r := require.New(t)
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	ch := make(shared.Challenge, 32)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	cfg, opts := verifying.GetTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(logger),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	proof, proofMetadata, err := proving.Generate(
+		context.Background(),
+		ch,
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		proving.LightMode(),
+	)
+	r.NoError(err)
+
+	verifier, err := verifying.NewProofVerifier()
+	r.NoError(err)
+	defer verifier.Close()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		time.Sleep(50 * time.Millisecond)
+		return verifier.Close()
+	})
+
+	for i := 0; i < 10; i++ {
+		ms := 10 * i
+		eg.Go(func() error {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return verifier.Verify(proof, proofMetadata, cfg, logger)
+		})
+	}
+
+	r.ErrorIs(eg.Wait(), postrs.ErrVerifierClosed)
+}
+
+func Test_Verify_Detects_invalid_proof(t *testing.T) {
+	r := require.New(t)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	ch := make(shared.Challenge, 32)
+
+	cfg, opts := verifying.GetTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+	proof, proofMetadata, err := proving.Generate(
+		context.Background(),
+		ch,
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		proving.LightMode(),
+	)
+	r.NoError(err)
+
+	// modify one of proof.Indices by zeroing out some bits
+	index := 1
+	numLabels := proofMetadata.LabelsPerUnit * uint64(proofMetadata.NumUnits)
+	bitsPerIndex := int(math.Log2(float64(numLabels))) + 1
+	mask := byte(1<<bitsPerIndex - 1)
+	offset := index * bitsPerIndex / 8
+	proof.Indices[offset] &= ^(mask << (index * bitsPerIndex % 8))
+
+	verifier, err := verifying.NewProofVerifier()
+	r.NoError(err)
+	defer verifier.Close()
+
+	// Verify selected index (valid)
+	err = verifier.Verify(proof, proofMetadata, cfg, logger, verifying.SelectedIndex(2))
+	require.NoError(t, err)
+
+	// Defaults to verifying all indices
+	err = verifier.Verify(proof, proofMetadata, cfg, logger)
+	expected := &verifying.ErrInvalidIndex{}
+	r.ErrorAs(err, &expected)
+	r.Equal(expected.Index, index)
+	var errLabel verifying.LabelRejectedError
+	r.ErrorAs(err, &errLabel)
+	r.ErrorIs(err, verifying.ErrLabelRejected)
+	r.Equal(index, errLabel.Ordinal)
+
+	// Verify with verifying.AllIndices option
+	err = verifier.Verify(proof, proofMetadata, cfg, logger, verifying.AllIndices())
+	r.ErrorAs(err, &expected)
+	r.Equal(expected.Index, index)
+
+	// Verify only 1 index with K3 = 1, the `index` was empirically picked to pass verification
+	err = verifier.Verify(proof, proofMetadata, cfg, logger, verifying.Subset(1, nodeId))
+	require.NoError(t, err)
+
+	// Verify selected index (invalid)
+	err = verifier.Verify(proof, proofMetadata, cfg, logger, verifying.SelectedIndex(index))
+	r.ErrorAs(err, &expected)
+	r.Equal(expected.Index, index)
+}
+
+func Test_VerifyAgainstData_GeneratedProof(t *testing.T) {
+	r := require.New(t)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	ch := make(shared.Challenge, 32)
+
+	cfg, opts := verifying.GetTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+	proof, proofMetadata, err := proving.Generate(
+		context.Background(),
+		ch,
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		proving.LightMode(),
+	)
+	r.NoError(err)
+
+	verify := func(proof *shared.Proof) *verifying.DataReport {
+		report, err := verifying.VerifyAgainstData(
+			context.Background(), proof, proofMetadata, cfg, opts.DataDir, logger,
+			verifying.WithLabelScryptParams(opts.Scrypt),
+		)
+		r.NoError(err)
+		r.Len(report.Indices, int(cfg.K2))
+		return report
+	}
+
+	report := verify(proof)
+	r.True(report.Healthy())
+	r.NoError(report.ProofErr)
+	for _, index := range report.Indices {
+		r.True(index.Candidate)
+		r.NoError(index.CandidateErr)
+	}
+
+	t.Run("corrupted label in the middle of the proof", func(t *testing.T) {
+		r := require.New(t)
+		middle := report.Indices[len(report.Indices)/2]
+		f, err := os.OpenFile(filepath.Join(opts.DataDir, shared.InitFileName(middle.FileIndex)), os.O_RDWR, 0)
+		r.NoError(err)
+		_, err = f.WriteAt(make([]byte, config.BytesPerLabel()), int64(middle.Offset))
+		r.NoError(err)
+		t.Cleanup(func() {
+			_, err := f.WriteAt(middle.Stored, int64(middle.Offset))
+			r.NoError(err)
+			r.NoError(f.Close())
+		})
+
+		report := verify(proof)
+		r.False(report.Healthy())
+		r.NoError(report.ProofErr)
+		for _, index := range report.Indices {
+			if index.Ordinal == middle.Ordinal {
+				r.Equal(verifying.DataCorrupt, index.Status)
+			} else {
+				r.Equal(verifying.DataHealthy, index.Status)
+			}
+			// the K1 condition is checked with the recomputed label, not the stored one
+			r.True(index.Candidate)
+		}
+	})
+
+	t.Run("index above K1", func(t *testing.T) {
+		r := require.New(t)
+		// replace the index at ordinal 1 with the index 0, like in Test_Verify_Detects_invalid_proof
+		numLabels := proofMetadata.LabelsPerUnit * uint64(proofMetadata.NumUnits)
+		indices, err := shared.DecodeIndices(proof.Indices, numLabels, cfg.K2)
+		r.NoError(err)
+		indices[1] = 0
+		encoded, err := shared.EncodeIndices(indices, numLabels)
+		r.NoError(err)
+
+		report := verify(&shared.Proof{Nonce: proof.Nonce, Indices: encoded, Pow: proof.Pow})
+		r.True(report.Healthy())
+		r.NoError(report.ProofErr)
+		for _, index := range report.Indices {
+			if index.Ordinal != 1 {
+				r.True(index.Candidate)
+				continue
+			}
+			r.False(index.Candidate)
+			var errLabel verifying.LabelRejectedError
+			r.ErrorAs(index.CandidateErr, &errLabel)
+			r.Equal(1, errLabel.Ordinal)
+		}
+	})
+}
+
+func BenchmarkVerifying(b *testing.B) {
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+
+	cfg, opts := verifying.GetTestConfig(b)
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+	)
+	require.NoError(b, err)
+	require.NoError(b, init.Initialize(context.Background()))
+
+	ch := make(shared.Challenge, 32)
+	rand.Read(ch)
+	p, m, err := proving.Generate(
+		context.Background(),
+		ch, cfg,
+		zaptest.NewLogger(b),
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+		proving.LightMode(),
+	)
+	require.NoError(b, err)
+
+	verifier, err := verifying.NewProofVerifier()
+	require.NoError(b, err)
+	defer verifier.Close()
+
+	for _, k3 := range []uint{5, 25, 50, 100} {
+		testName := fmt.Sprintf("k3=%d", k3)
+
+		b.Run(testName, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				err := verifier.Verify(p, m, cfg, zaptest.NewLogger(b), verifying.Subset(k3, nodeId))
+				require.NoError(b, err)
+				b.ReportMetric(time.Since(start).Seconds(), "sec/proof")
+			}
+		})
+	}
+}
@@ -15,9 +15,50 @@ import (
 // Reexport from internal pkg.
 type ErrInvalidIndex = postrs.ErrInvalidIndex
 
+// Reasons for a proof to fail verification. Errors returned by Verify match one of the sentinels with errors.Is
+// and can be inspected as their typed error with errors.As.
+//
+// libpost only reports the ordinal of an invalid index or that the proof is invalid. The metadata, the number of
+// indices and whether an invalid index is in range are checked from the proof. Other failures are reported as
+// ErrProofRejected (e.g. an invalid PoW) or ErrLabelRejected (a label that doesn't satisfy the K1 threshold),
+// libpost doesn't report their reason. Arguments rejected by libpost match ErrInvalidArgument and wrap an
+// InvalidArgumentError or one of the typed errors above.
+var (
+	ErrProofRejected          = postrs.ErrProofRejected
+	ErrInvalidNumberOfIndices = postrs.ErrInvalidNumberOfIndices
+	ErrIndexOutOfRange        = postrs.ErrIndexOutOfRange
+	ErrLabelRejected          = postrs.ErrLabelRejected
+	ErrInvalidMetadata        = postrs.ErrInvalidMetadata
+	ErrInvalidArgument        = postrs.ErrInvalidArgument
+)
+
+type (
+	ProofRejectedError          = postrs.ProofRejectedError
+	InvalidNumberOfIndicesError = postrs.InvalidNumberOfIndicesError
+	IndexOutOfRangeError        = postrs.IndexOutOfRangeError
+	LabelRejectedError          = postrs.LabelRejectedError
+	InvalidMetadataError        = postrs.InvalidMetadataError
+	InvalidArgumentError        = postrs.InvalidArgumentError
+)
+
 // VerifyVRFNonce ensures the validity of a nonce for a given node.
 // AtxId is the id of the ATX that was selected by the node for its commitment.
 func VerifyVRFNonce(nonce *uint64, m *shared.VRFNonceMetadata, opts ...OptionFunc) error {
+	if err := validateVRFNonce(nonce, m); err != nil {
+		return err
+	}
+
+	options := applyOpts(opts...)
+	wo, err := newVRFOracle(m, options.labelScrypt)
+	if err != nil {
+		return err
+	}
+	defer wo.Close()
+
+	return verifyVRFNonce(wo, *nonce, m)
+}
+
+func validateVRFNonce(nonce *uint64, m *shared.VRFNonceMetadata) error {
 	if nonce == nil {
 		return errors.New("invalid `nonce` value; expected: non-nil, given: nil")
 	}
@@ -29,30 +70,33 @@ func VerifyVRFNonce(nonce *uint64, m *shared.VRFNonceMetadata, opts ...OptionFun
 	if len(m.CommitmentAtxId) != 32 {
 		return fmt.Errorf("invalid `commitmentAtxId` length; expected: 32, given: %v", len(m.CommitmentAtxId))
 	}
+	return nil
+}
 
-	options := applyOpts(opts...)
-	numLabels := uint64(m.NumUnits) * uint64(m.LabelsPerUnit)
-	difficulty := shared.PowDifficulty(numLabels)
-
+// newVRFOracle creates a CPU oracle that computes the labels of the identity in `m`.
+func newVRFOracle(m *shared.VRFNonceMetadata, scrypt config.ScryptParams) (*oracle.WorkOracle, error) {
 	cpuProviderID := postrs.CPUProviderID()
-	wo, err := oracle.New(
+	return oracle.New(
 		oracle.WithProviderID(&cpuProviderID),
 		oracle.WithCommitment(oracle.CommitmentBytes(m.NodeId, m.CommitmentAtxId)),
-		oracle.WithScryptParams(options.labelScrypt),
-		oracle.WithVRFDifficulty(difficulty),
+		oracle.WithScryptParams(scrypt),
+		oracle.WithVRFDifficulty(vrfDifficulty(m)),
 	)
-	if err != nil {
-		return err
-	}
-	defer wo.Close()
+}
 
-	res, err := wo.Position(*nonce)
+func vrfDifficulty(m *shared.VRFNonceMetadata) []byte {
+	numLabels := uint64(m.NumUnits) * uint64(m.LabelsPerUnit)
+	return shared.PowDifficulty(numLabels)
+}
+
+func verifyVRFNonce(wo *oracle.WorkOracle, nonce uint64, m *shared.VRFNonceMetadata) error {
+	res, err := wo.Position(nonce)
 	if err != nil {
 		return err
 	}
 
-	if res.Nonce == nil || *res.Nonce != *nonce {
-		return fmt.Errorf("nonce %v is not valid for node %v", *nonce, m.NodeId)
+	if res.Nonce == nil || *res.Nonce != nonce {
+		return fmt.Errorf("nonce %v is not valid for node %v", nonce, m.NodeId)
 	}
 
 	return nil
@@ -75,7 +119,8 @@ func NewProofVerifier(opts ...OptionFunc) (*ProofVerifier, error) {
 }
 
 // Verify ensures the validity of a proof in respect to its metadata.
-// It returns nil if the proof is valid or an error describing the failure, otherwise.
+// It returns nil if the proof is valid or an error describing the failure, otherwise. Invalid proofs are reported
+// with the typed errors above, e.g. LabelRejectedError.
 func (v *ProofVerifier) Verify(
 	p *shared.Proof,
 	m *shared.ProofMetadata,
@@ -83,13 +128,6 @@ func (v *ProofVerifier) Verify(
 	logger *zap.Logger,
 	opts ...OptionFunc,
 ) error {
-	if len(m.NodeId) != 32 {
-		return fmt.Errorf("invalid `nodeId` length; expected: 32, given: %v", len(m.NodeId))
-	}
-	if len(m.CommitmentAtxId) != 32 {
-		return fmt.Errorf("invalid `commitmentAtxId` length; expected: 32, given: %v", len(m.CommitmentAtxId))
-	}
-
 	options := applyOpts(opts...)
 	scryptParams := postrs.NewScryptParams(options.labelScrypt.N, options.labelScrypt.R, options.labelScrypt.P)
 	return v.VerifyProof(p, m, logger, postrs.Config(cfg), scryptParams, options.internalOpts...)
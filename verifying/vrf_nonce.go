@@ -0,0 +1,216 @@
+package verifying
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/shared"
+)
+
+// ErrVRFNonceVerifierClosed is returned when verifying a nonce with a closed VRFNonceVerifier.
+var ErrVRFNonceVerifierClosed = errors.New("vrf nonce verifier has been closed")
+
+// VRFNonceRequest is a nonce to verify with VRFNonceVerifier.VerifyBatch.
+type VRFNonceRequest struct {
+	Nonce    *uint64
+	Metadata *shared.VRFNonceMetadata
+	// Opts are applied like for VerifyVRFNonce.
+	Opts []OptionFunc
+}
+
+type vrfNonceVerifierOption struct {
+	maxOracles int
+}
+
+type VRFNonceVerifierOptionFunc func(*vrfNonceVerifierOption)
+
+// WithMaxOracles sets the maximum number of oracles kept by a VRFNonceVerifier. It is also the number of nonces
+// verified at the same time. Defaults to the number of CPUs.
+func WithMaxOracles(n int) VRFNonceVerifierOptionFunc {
+	return func(o *vrfNonceVerifierOption) {
+		o.maxOracles = n
+	}
+}
+
+// oracleKey identifies the oracles that can verify the same nonces.
+type oracleKey struct {
+	commitment string
+	scrypt     config.ScryptParams
+	difficulty string
+}
+
+type pooledOracle struct {
+	key oracleKey
+	*oracle.WorkOracle
+}
+
+// VRFNonceVerifier verifies VRF nonces like VerifyVRFNonce. Instead of creating an oracle for every nonce it keeps
+// a bounded pool of oracles for the identities it has seen, so verifying many nonces of the same identities
+// doesn't pay the setup of an oracle every time.
+//
+// The verifier must be closed after use with Close().
+type VRFNonceVerifier struct {
+	// tokens limits the number of oracles in use
+	tokens chan struct{}
+
+	mtx sync.Mutex
+	// idle oracles, the least recently used first
+	idle   []pooledOracle
+	inUse  int
+	max    int
+	closed bool
+
+	// newOracle is newVRFOracle, replaced in tests.
+	newOracle func(m *shared.VRFNonceMetadata, scrypt config.ScryptParams) (*oracle.WorkOracle, error)
+}
+
+// NewVRFNonceVerifier creates a new VRFNonceVerifier.
+func NewVRFNonceVerifier(opts ...VRFNonceVerifierOptionFunc) (*VRFNonceVerifier, error) {
+	options := vrfNonceVerifierOption{
+		maxOracles: runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.maxOracles < 1 {
+		return nil, fmt.Errorf("invalid `maxOracles`; expected: >= 1, given: %d", options.maxOracles)
+	}
+
+	return &VRFNonceVerifier{
+		tokens:    make(chan struct{}, options.maxOracles),
+		max:       options.maxOracles,
+		newOracle: newVRFOracle,
+	}, nil
+}
+
+// Verify ensures the validity of a nonce for a given node. It returns the same result as VerifyVRFNonce.
+func (v *VRFNonceVerifier) Verify(nonce *uint64, m *shared.VRFNonceMetadata, opts ...OptionFunc) error {
+	return v.verify(context.Background(), nonce, m, opts...)
+}
+
+// VerifyBatch verifies the nonces of `requests` concurrently. The result for requests[i] is returned at index i.
+// If `ctx` is canceled the nonces that weren't verified yet fail with ctx.Err().
+func (v *VRFNonceVerifier) VerifyBatch(ctx context.Context, requests []VRFNonceRequest) []error {
+	results := make([]error, len(requests))
+	var eg errgroup.Group
+	eg.SetLimit(v.max)
+	for i, req := range requests {
+		i, req := i, req
+		eg.Go(func() error {
+			results[i] = v.verify(ctx, req.Nonce, req.Metadata, req.Opts...)
+			return nil
+		})
+	}
+	eg.Wait()
+	return results
+}
+
+func (v *VRFNonceVerifier) verify(
+	ctx context.Context,
+	nonce *uint64,
+	m *shared.VRFNonceMetadata,
+	opts ...OptionFunc,
+) error {
+	if err := validateVRFNonce(nonce, m); err != nil {
+		return err
+	}
+
+	options := applyOpts(opts...)
+	wo, err := v.acquire(ctx, m, options.labelScrypt)
+	if err != nil {
+		return err
+	}
+	defer v.release(wo)
+	return verifyVRFNonce(wo.WorkOracle, *nonce, m)
+}
+
+// acquire returns an oracle for `m` and `scrypt` for exclusive use. It must be returned with release.
+func (v *VRFNonceVerifier) acquire(
+	ctx context.Context,
+	m *shared.VRFNonceMetadata,
+	scrypt config.ScryptParams,
+) (pooledOracle, error) {
+	if err := ctx.Err(); err != nil {
+		return pooledOracle{}, err
+	}
+	select {
+	case v.tokens <- struct{}{}:
+	case <-ctx.Done():
+		return pooledOracle{}, ctx.Err()
+	}
+
+	key := oracleKey{
+		commitment: string(oracle.CommitmentBytes(m.NodeId, m.CommitmentAtxId)),
+		scrypt:     scrypt,
+		difficulty: string(vrfDifficulty(m)),
+	}
+
+	v.mtx.Lock()
+	if v.closed {
+		v.mtx.Unlock()
+		<-v.tokens
+		return pooledOracle{}, ErrVRFNonceVerifierClosed
+	}
+	for i := len(v.idle) - 1; i >= 0; i-- {
+		if v.idle[i].key == key {
+			wo := v.idle[i]
+			v.idle = append(v.idle[:i], v.idle[i+1:]...)
+			v.inUse++
+			v.mtx.Unlock()
+			return wo, nil
+		}
+	}
+	// make room for a new oracle by closing the least recently used one
+	var evicted *oracle.WorkOracle
+	if v.inUse+len(v.idle) >= v.max {
+		evicted = v.idle[0].WorkOracle
+		v.idle = v.idle[1:]
+	}
+	v.inUse++
+	v.mtx.Unlock()
+
+	if evicted != nil {
+		evicted.Close()
+	}
+	wo, err := v.newOracle(m, scrypt)
+	if err != nil {
+		v.mtx.Lock()
+		v.inUse--
+		v.mtx.Unlock()
+		<-v.tokens
+		return pooledOracle{}, err
+	}
+	return pooledOracle{key: key, WorkOracle: wo}, nil
+}
+
+func (v *VRFNonceVerifier) release(wo pooledOracle) {
+	v.mtx.Lock()
+	v.inUse--
+	if v.closed {
+		v.mtx.Unlock()
+		wo.Close()
+	} else {
+		v.idle = append(v.idle, wo)
+		v.mtx.Unlock()
+	}
+	<-v.tokens
+}
+
+// Close closes the pooled oracles. Oracles that are in use are closed when their verification finishes.
+func (v *VRFNonceVerifier) Close() error {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.closed = true
+	for _, wo := range v.idle {
+		wo.Close()
+	}
+	v.idle = nil
+	return nil
+}
@@ -0,0 +1,145 @@
+package verifying
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/shared"
+)
+
+// initVRFNonce initializes data for `nodeId` and returns its nonce and metadata.
+func initVRFNonce(t *testing.T, nodeId byte) (*uint64, *shared.VRFNonceMetadata, config.ScryptParams) {
+	cfg, opts := getTestConfig(t)
+	opts.Scrypt.N = 16
+	id := make([]byte, 32)
+	id[0] = nodeId
+	commitmentAtxId := make([]byte, 32)
+
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(id),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+	require.NotNil(t, init.Nonce())
+
+	return init.Nonce(), &shared.VRFNonceMetadata{
+		NodeId:          id,
+		CommitmentAtxId: commitmentAtxId,
+		NumUnits:        opts.NumUnits,
+		LabelsPerUnit:   cfg.LabelsPerUnit,
+	}, opts.Scrypt
+}
+
+func countOracles(v *VRFNonceVerifier) *atomic.Int32 {
+	var created atomic.Int32
+	v.newOracle = func(m *shared.VRFNonceMetadata, scrypt config.ScryptParams) (*oracle.WorkOracle, error) {
+		created.Add(1)
+		return newVRFOracle(m, scrypt)
+	}
+	return &created
+}
+
+func TestVRFNonceVerifier_MatchesVerifyVRFNonce(t *testing.T) {
+	nonce1, m1, scrypt := initVRFNonce(t, 1)
+	nonce2, m2, _ := initVRFNonce(t, 2)
+	otherNonce := *nonce1 + 1
+	wrongScrypt := scrypt
+	wrongScrypt.N = 32
+	wrongNodeId := *m1
+	wrongNodeId.NodeId = m2.NodeId
+
+	requests := []VRFNonceRequest{
+		{Nonce: nonce1, Metadata: m1, Opts: []OptionFunc{WithLabelScryptParams(scrypt)}},
+		{Nonce: nonce2, Metadata: m2, Opts: []OptionFunc{WithLabelScryptParams(scrypt)}},
+		{Nonce: &otherNonce, Metadata: m1, Opts: []OptionFunc{WithLabelScryptParams(scrypt)}},
+		{Nonce: nonce1, Metadata: m1, Opts: []OptionFunc{WithLabelScryptParams(wrongScrypt)}},
+		{Nonce: nonce1, Metadata: &wrongNodeId, Opts: []OptionFunc{WithLabelScryptParams(scrypt)}},
+		{Nonce: nonce1, Metadata: m1},
+		{Nonce: nil, Metadata: m1},
+		{Nonce: nonce1, Metadata: &shared.VRFNonceMetadata{NodeId: m1.NodeId}},
+	}
+	// every request is verified several times to reuse the pooled oracles
+	for i := 0; i < 3; i++ {
+		requests = append(requests, requests[:8]...)
+	}
+
+	verifier, err := NewVRFNonceVerifier(WithMaxOracles(3))
+	require.NoError(t, err)
+	defer verifier.Close()
+	created := countOracles(verifier)
+
+	results := verifier.VerifyBatch(context.Background(), requests)
+	require.Len(t, results, len(requests))
+	require.NoError(t, results[0])
+	require.NoError(t, results[1])
+	for i, req := range requests {
+		expected := VerifyVRFNonce(req.Nonce, req.Metadata, req.Opts...)
+		if expected == nil {
+			require.NoError(t, results[i], "request %d", i)
+		} else {
+			require.EqualError(t, results[i], expected.Error(), "request %d", i)
+		}
+	}
+	// the 6 distinct identities and scrypt params need at most one oracle per verification
+	require.LessOrEqual(t, created.Load(), int32(6*4))
+	require.LessOrEqual(t, verifier.inUse+len(verifier.idle), 3)
+}
+
+func TestVRFNonceVerifier_ReusesOracles(t *testing.T) {
+	nonce1, m1, scrypt := initVRFNonce(t, 1)
+	nonce2, m2, _ := initVRFNonce(t, 2)
+
+	verifier, err := NewVRFNonceVerifier(WithMaxOracles(2))
+	require.NoError(t, err)
+	created := countOracles(verifier)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, verifier.Verify(nonce1, m1, WithLabelScryptParams(scrypt)))
+		require.NoError(t, verifier.Verify(nonce2, m2, WithLabelScryptParams(scrypt)))
+	}
+	require.EqualValues(t, 2, created.Load())
+	require.Len(t, verifier.idle, 2)
+
+	// a third identity evicts the least recently used oracle
+	nonce3, m3, _ := initVRFNonce(t, 3)
+	require.NoError(t, verifier.Verify(nonce3, m3, WithLabelScryptParams(scrypt)))
+	require.EqualValues(t, 3, created.Load())
+	require.Len(t, verifier.idle, 2)
+	require.NoError(t, verifier.Verify(nonce2, m2, WithLabelScryptParams(scrypt)))
+	require.EqualValues(t, 3, created.Load())
+	require.NoError(t, verifier.Verify(nonce1, m1, WithLabelScryptParams(scrypt)))
+	require.EqualValues(t, 4, created.Load())
+
+	require.NoError(t, verifier.Close())
+	require.ErrorIs(t, verifier.Verify(nonce1, m1, WithLabelScryptParams(scrypt)), ErrVRFNonceVerifierClosed)
+	require.Empty(t, verifier.idle)
+}
+
+func TestVRFNonceVerifier_Canceled(t *testing.T) {
+	nonce, m, scrypt := initVRFNonce(t, 1)
+
+	verifier, err := NewVRFNonceVerifier()
+	require.NoError(t, err)
+	defer verifier.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := verifier.VerifyBatch(ctx, []VRFNonceRequest{
+		{Nonce: nonce, Metadata: m, Opts: []OptionFunc{WithLabelScryptParams(scrypt)}},
+	})
+	require.ErrorIs(t, results[0], context.Canceled)
+}
+
+func TestNewVRFNonceVerifier_Invalid(t *testing.T) {
+	_, err := NewVRFNonceVerifier(WithMaxOracles(0))
+	require.ErrorContains(t, err, "invalid `maxOracles`")
+}